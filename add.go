@@ -4,21 +4,59 @@ import (
 	"context"
 	"errors"
 	"github.com/nextzhou/workpool"
-	"sync"
 )
 
 type docMeta struct {
-	id  string
-	tf  map[string]map[string]uint32
+	id     string
+	fields map[string]fieldMeta
+	src    map[string][]string
+}
+
+type fieldMeta struct {
+	tf  map[string]uint32
+	pos map[string][]uint32
 	len int
 }
 
+// idTS lists the tokens of a document so it can be removed again. T and S
+// belong to the unnamed field, F to the named ones.
 type idTS struct {
 	T []string
 	S uint32
+	F map[string]fieldTS
+}
+
+type fieldTS struct {
+	T []string
+	S uint32
 }
 
+func (ts idTS) fields() map[string]fieldTS {
+	fields := make(map[string]fieldTS, len(ts.F)+1)
+	if len(ts.T) != 0 || ts.S != 0 {
+		fields[""] = fieldTS{ts.T, ts.S}
+	}
+	for field, fts := range ts.F {
+		fields[field] = fts
+	}
+	return fields
+}
+
+// AddDocs indexes docs by id. A document whose id is already indexed is
+// replaced: its old tokens and length are removed in the same batch.
 func (fulltext *Fulltext) AddDocs(index string, docs map[string]string) error {
+	documents := make([]*Document, 0, len(docs))
+	for id, doc := range docs {
+		documents = append(documents, NewDocument(id).Add("", doc))
+	}
+
+	return fulltext.AddDocuments(index, documents...)
+}
+
+// AddDocuments indexes documents with named fields and replaces the ones
+// already indexed, like AddDocs. Fields missing from the mapping of index
+// are added to it as text fields.
+func (fulltext *Fulltext) AddDocuments(index string, docs ...*Document) error {
 	l := len(docs)
 	if l == 0 {
 		return nil
@@ -26,118 +64,252 @@ func (fulltext *Fulltext) AddDocs(index string, docs map[string]string) error {
 		return errors.New("fulltext/add: too much docs")
 	}
 
-	tf := make(map[string]map[string]uint32)
-	idf := make(map[string]uint32)
-	docsMeta := make([]docMeta, 0, l)
+	unlock := fulltext.lock(index)
+	defer unlock()
 
-	if l == 1 {
-		for id, doc := range docs {
-			docsMeta = append(docsMeta, fulltext.analyse(id, doc))
-		}
-	} else { // batch
-		var limit uint = 5
-		if l < 5 {
-			limit = uint(l)
-		}
+	r := reader{fulltext.db}
 
-		var mutex sync.Mutex
-		wp := workpool.New(context.TODO(), workpool.Options.ParallelLimit(limit))
-		for id, doc := range docs {
-			id := id
-			doc := doc
-			wp.Go(func(ctx context.Context) error {
-				mutex.Lock()
-				defer mutex.Unlock()
-				docsMeta = append(docsMeta, fulltext.analyse(id, doc))
-				return nil
-			})
-		}
-		if err := wp.Wait(); err != nil {
+	mapping, err := r.mapping(index)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := checkDoc(doc); err != nil {
 			return err
 		}
 	}
+	newMapping := dynamicMapping(mapping, docs)
+	if newMapping != nil {
+		mapping = newMapping
+	}
 
-	ts, err := fulltext.ts(index)
+	docsMeta, err := fulltext.analyseDocs(mapping, docs)
 	if err != nil {
 		return err
 	}
 
-	ds, err := fulltext.ds(index)
+	c, err := newChange(r, index)
 	if err != nil {
 		return err
 	}
+	c.mapping = newMapping
+	if err := c.loadFree(len(docsMeta)); err != nil {
+		return err
+	}
 
-	idt := make(map[string]idTS)
 	for _, meta := range docsMeta {
+		if _, exist := c.idt[meta.id]; exist {
+			return errors.New("fulltext/add: duplicate doc id " + meta.id)
+		}
+		if err := c.index(meta); err != nil {
+			return err
+		}
+	}
 
-		ts += uint64(meta.len)
-		ds++
+	if err = fulltext.putMeta(index, c); err != nil {
+		return err
+	}
 
-		t := make([]string, 0, len(meta.tf))
-		for token, idTF := range meta.tf {
-			t = append(t, token)
+	return nil
+}
 
-			if _, exist := tf[token]; !exist {
-				tfVal, err := fulltext.tf(index, token)
-				if err != nil {
-					return err
-				}
+// checkDoc rejects a document that cannot be indexed.
+func checkDoc(doc *Document) error {
+	if doc == nil {
+		return errors.New("fulltext/add: nil document")
+	}
+	for field := range doc.Fields {
+		if err := checkField(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-				if tfVal != nil {
-					tf[token] = tfVal
-				} else {
-					tf[token] = make(map[string]uint32)
-				}
+// dynamicMapping returns mapping with the fields of docs it misses added as
+// text fields, or nil when it has them all.
+func dynamicMapping(mapping *Mapping, docs []*Document) *Mapping {
+	var newMapping *Mapping
+	for _, doc := range docs {
+		for field := range doc.Fields {
+			if field == "" || mapping.has(field) {
+				continue
 			}
-
-			for id, tfVal := range idTF {
-				if _, exist := idf[token]; !exist {
-					idfVal, err := fulltext.idf(index, token)
-					if err != nil {
-						return err
+			if newMapping == nil {
+				newMapping = &Mapping{Fields: make(map[string]FieldMapping)}
+				if mapping != nil {
+					newMapping.Source = mapping.Source
+					newMapping.Analyzer = mapping.Analyzer
+					for name, f := range mapping.Fields {
+						newMapping.Fields[name] = f
 					}
-					idf[token] = idfVal + 1
-				} else {
-					idf[token]++
 				}
-
-				tf[token][id] = tfVal
+				mapping = newMapping
 			}
+			newMapping.Fields[field] = FieldMapping{Type: FieldText}
 		}
+	}
+
+	return newMapping
+}
+
+// analyseDocs analyses docs in parallel, keeping their order.
+func (fulltext *Fulltext) analyseDocs(mapping *Mapping, docs []*Document) ([]docMeta, error) {
+	l := len(docs)
+	docsMeta := make([]docMeta, l)
 
-		idt[meta.id] = idTS{t, uint32(meta.len)}
+	if l == 1 {
+		meta, err := fulltext.analyse(mapping, docs[0])
+		docsMeta[0] = meta
+		return docsMeta, err
+	}
+
+	var limit uint = 5
+	if l < 5 {
+		limit = uint(l)
+	}
+
+	wp := workpool.New(context.TODO(), workpool.Options.ParallelLimit(limit))
+	for k, doc := range docs {
+		k, doc := k, doc
+		wp.Go(func(ctx context.Context) error {
+			meta, err := fulltext.analyse(mapping, doc)
+			docsMeta[k] = meta
+			return err
+		})
 	}
+	if err := wp.Wait(); err != nil {
+		return nil, err
+	}
+
+	return docsMeta, nil
+}
 
-	if err = fulltext.addMeta(index, tf, idf, idt, ts, ds); err != nil {
+// index adds a document to the change. An existing document is replaced, so
+// its old contribution is taken out first. It keeps its number.
+func (c *change) index(meta docMeta) error {
+	ok, old, err := c.r.docT(c.i, meta.id)
+	if err != nil {
 		return err
 	}
+	num, numbered, err := c.r.docNum(c.i, meta.id)
+	if err != nil {
+		return err
+	}
+	if !numbered {
+		num = c.alloc()
+	}
+	c.nums[meta.id] = num
+	if ok {
+		if err := c.unindex(old, num); err != nil {
+			return err
+		}
+	}
+
+	c.ds++
+
+	t := idTS{}
+	for field, fm := range meta.fields {
+		if err := c.loadTS(field); err != nil {
+			return err
+		}
+		c.ts[field] += uint64(fm.len)
+
+		tokens := make([]string, 0, len(fm.tf))
+		for token, tfVal := range fm.tf {
+			tokens = append(tokens, token)
+
+			ft := fieldToken{field, token}
+			added, err := c.postings.put(ft, posting{doc: num, tf: tfVal, pos: fm.pos[token]})
+			if err != nil {
+				return err
+			}
+			if !added {
+				continue
+			}
+			if err := c.loadIDF(ft); err != nil {
+				return err
+			}
+			c.idf[ft]++
+		}
+
+		if field == "" {
+			t.T, t.S = tokens, uint32(fm.len)
+			continue
+		}
+		if t.F == nil {
+			t.F = make(map[string]fieldTS)
+		}
+		t.F[field] = fieldTS{tokens, uint32(fm.len)}
+	}
+
+	c.idt[meta.id] = t
+	if meta.src != nil {
+		c.srcs[meta.id] = meta.src
+	}
 
 	return nil
 }
 
-func (fulltext *Fulltext) analyse(id string, doc string) docMeta {
-	content := make(map[string]map[string]uint32)
-	tokens := fulltext.tokenizer.Seg(doc)
+func (fulltext *Fulltext) analyse(mapping *Mapping, doc *Document) (docMeta, error) {
+	fields := make(map[string]fieldMeta, len(doc.Fields))
 
-	tf, ts := fulltext.termFreq(tokens)
+	for field, values := range doc.Fields {
+		if mapping.field(field).Type == FieldKeyword {
+			fields[field] = keywordFreq(values)
+			continue
+		}
+
+		analyzer, err := fulltext.analyzer(mapping, field)
+		if err != nil {
+			return docMeta{}, err
+		}
+
+		// the values follow each other, as if they were one text
+		var tokens []Token
+		base := 0
+		for _, value := range values {
+			_, valueTokens, n := analyzer.analyze(value)
+			for _, token := range valueTokens {
+				token.Pos += base
+				tokens = append(tokens, token)
+			}
+			base += n
+		}
 
-	for t, f := range tf {
-		content[t] = make(map[string]uint32)
-		content[t][id] = f
+		tf, pos, ts := termFreq(tokens)
+		fields[field] = fieldMeta{tf, pos, ts}
 	}
 
-	return docMeta{id, content, ts}
+	return docMeta{doc.ID, fields, mapping.stored(doc)}, nil
 }
 
-func (fulltext *Fulltext) termFreq(tokens []string) (map[string]uint32, int) {
+// termFreq counts the tokens and records where they occur. The length counts
+// positions, so the synonyms of a token do not make a field longer, and
+// tokens dropped by the analyzer still leave a gap between their neighbours.
+func termFreq(tokens []Token) (map[string]uint32, map[string][]uint32, int) {
 	tf := make(map[string]uint32)
+	pos := make(map[string][]uint32)
 	var ts int
+	last := -1
 	for _, token := range tokens {
-		if _, exist := fulltext.stopWords[token]; exist {
-			continue
+		tf[token.Term]++
+		pos[token.Term] = append(pos[token.Term], uint32(token.Pos))
+		if token.Pos != last {
+			ts++
+			last = token.Pos
 		}
-		tf[token]++
-		ts++
 	}
-	return tf, ts
+	return tf, pos, ts
+}
+
+// keywordFreq indexes every value of a keyword field as one token.
+func keywordFreq(values []string) fieldMeta {
+	tf := make(map[string]uint32)
+	pos := make(map[string][]uint32)
+	for p, value := range values {
+		tf[value]++
+		pos[value] = append(pos[value], uint32(p))
+	}
+	return fieldMeta{tf, pos, len(values)}
 }
@@ -0,0 +1,455 @@
+package fulltext
+
+import (
+	"errors"
+	"fmt"
+	"github.com/744189447/fulltext/stem"
+	"golang.org/x/text/unicode/norm"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is a term produced by an Analyzer. Pos is the index of the word the
+// tokenizer cut it from, tokens of the same word share it. Start and End are
+// the byte offsets of the word in the char filtered text, -1 when it can not
+// be found back.
+type Token struct {
+	Term  string
+	Pos   int
+	Start int
+	End   int
+}
+
+// CharFilter rewrites a text before it is tokenized.
+type CharFilter interface {
+	Filter(text string) string
+}
+
+// TokenFilter rewrites, drops or adds tokens after the tokenizer.
+type TokenFilter interface {
+	Filter(tokens []Token) []Token
+}
+
+// Analyzer turns a text into the tokens that are indexed and searched: the
+// char filters run in order on the text, the tokenizer cuts it and the token
+// filters run in order on the tokens. Documents and queries go through the
+// analyzer of their field, so both are analysed the same way.
+type Analyzer struct {
+	CharFilters  []CharFilter
+	Tokenizer    Tokenizer
+	TokenFilters []TokenFilter
+}
+
+// Analyze returns the tokens of text.
+func (a *Analyzer) Analyze(text string) []Token {
+	_, tokens, _ := a.analyze(text)
+	return tokens
+}
+
+// analyze also returns the char filtered text the offsets refer to, and the
+// number of positions the tokenizer used.
+func (a *Analyzer) analyze(text string) (string, []Token, int) {
+	for _, f := range a.CharFilters {
+		text = f.Filter(text)
+	}
+
+	words := a.Tokenizer.Seg(text)
+	tokens := offsets(words, text)
+	for _, f := range a.TokenFilters {
+		tokens = f.Filter(tokens)
+	}
+
+	return text, tokens, len(words)
+}
+
+// terms returns the terms of text, in order.
+func (a *Analyzer) terms(text string) []string {
+	tokens := a.Analyze(text)
+	terms := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		terms = append(terms, token.Term)
+	}
+	return terms
+}
+
+// literal analyses a literal part of a pattern: every run of letters and
+// digits is replaced by its only term, else lowered, and the other characters
+// are kept as they are.
+func (a *Analyzer) literal(str string) string {
+	var b strings.Builder
+	for str != "" {
+		n := strings.IndexFunc(str, func(c rune) bool { return !unicode.IsLetter(c) && !unicode.IsDigit(c) })
+		if n == 0 {
+			_, n = utf8.DecodeRuneInString(str)
+			b.WriteString(str[:n])
+			str = str[n:]
+			continue
+		}
+		if n < 0 {
+			n = len(str)
+		}
+		if terms := a.terms(str[:n]); len(terms) == 1 {
+			b.WriteString(terms[0])
+		} else {
+			b.WriteString(strings.ToLower(str[:n]))
+		}
+		str = str[n:]
+	}
+	return b.String()
+}
+
+// normalize runs term through the token filters only, for the terms a query
+// gives as they are. It returns false when a filter drops it.
+func (a *Analyzer) normalize(term string) (string, bool) {
+	tokens := []Token{{Term: term, Start: 0, End: len(term)}}
+	for _, f := range a.TokenFilters {
+		tokens = f.Filter(tokens)
+	}
+	if len(tokens) == 0 {
+		return "", false
+	}
+	return tokens[0].Term, true
+}
+
+// offsets finds the words back in text. Words are searched after the previous
+// one, or from the start of a run of overlapping words, as search mode
+// segmenters emit the parts of a word before the word itself. Empty words
+// are dropped but keep their position.
+func offsets(words []string, text string) []Token {
+	// offsets are only kept by lowering when it keeps the byte length
+	lower := strings.ToLower(text)
+	folded := len(lower) == len(text)
+	if !folded {
+		lower = text
+	}
+
+	tokens := make([]Token, 0, len(words))
+	last, runStart, runEnd := -1, 0, 0
+	for p, word := range words {
+		if word == "" {
+			continue
+		}
+		token := Token{Term: word, Pos: p, Start: -1, End: -1}
+
+		needle := word
+		if folded {
+			needle = strings.ToLower(word)
+		}
+
+		idx := strings.Index(lower[last+1:], needle)
+		if idx >= 0 {
+			idx += last + 1
+		} else if idx = strings.Index(lower[runStart:], needle); idx >= 0 {
+			idx += runStart
+		}
+		if idx >= 0 {
+			end := idx + len(needle)
+			if idx >= runEnd {
+				runStart = idx
+			}
+			if end > runEnd {
+				runEnd = end
+			}
+			last = idx
+			token.Start, token.End = idx, end
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
+
+// RegisterAnalyzer makes analyzer available under name to the mappings of
+// every index, as Mapping.Analyzer or FieldMapping.Analyzer. Analyzers are
+// not stored: they must be registered again each time the indexes are
+// opened, before they are used. A nil Tokenizer is the one of the Fulltext.
+func (fulltext *Fulltext) RegisterAnalyzer(name string, analyzer *Analyzer) error {
+	if name == "" {
+		return errors.New("fulltext/analysis: analyzer name is empty")
+	}
+	if analyzer == nil {
+		return errors.New("fulltext/analysis: analyzer is nil")
+	}
+
+	fulltext.analyzers.Store(name, fulltext.withTokenizer(analyzer))
+	return nil
+}
+
+// withTokenizer returns analyzer, with the tokenizer of the Fulltext if it has
+// none.
+func (fulltext *Fulltext) withTokenizer(analyzer *Analyzer) *Analyzer {
+	if analyzer.Tokenizer != nil {
+		return analyzer
+	}
+	a := *analyzer
+	a.Tokenizer = fulltext.tokenizer
+	return &a
+}
+
+// analyzer returns the analyzer of field: the one of the field mapping, else
+// the one of the index, else the default one.
+func (fulltext *Fulltext) analyzer(mapping *Mapping, field string) (*Analyzer, error) {
+	name := mapping.field(field).Analyzer
+	if name == "" && mapping != nil {
+		name = mapping.Analyzer
+	}
+	if name == "" {
+		return fulltext.defaultAnalyzer, nil
+	}
+
+	analyzer, exist := fulltext.analyzers.Load(name)
+	if !exist {
+		return nil, fmt.Errorf("fulltext/analysis: unknown analyzer %q", name)
+	}
+	return analyzer.(*Analyzer), nil
+}
+
+// HTMLStripFilter removes the tags, comments, scripts and styles of an HTML
+// text and decodes its entities. Tags other than inline ones, like p or br,
+// leave a space so the words around them are not glued together.
+type HTMLStripFilter struct{}
+
+var inlineTags = map[string]struct{}{
+	"a": {}, "abbr": {}, "b": {}, "bdi": {}, "bdo": {}, "cite": {}, "code": {},
+	"data": {}, "dfn": {}, "em": {}, "font": {}, "i": {}, "kbd": {}, "mark": {},
+	"q": {}, "s": {}, "samp": {}, "small": {}, "span": {}, "strike": {},
+	"strong": {}, "sub": {}, "sup": {}, "time": {}, "tt": {}, "u": {}, "var": {},
+}
+
+func (HTMLStripFilter) Filter(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] != '<' {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(text[i:], "<!--") {
+			end := strings.Index(text[i+4:], "-->")
+			if end < 0 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+
+		end := strings.IndexByte(text[i:], '>')
+		if end < 0 {
+			b.WriteString(text[i:])
+			break
+		}
+		tag := text[i+1 : i+end]
+		name := tagName(tag)
+		i += end + 1
+
+		if (name == "script" || name == "style") && !strings.HasPrefix(tag, "/") {
+			// the content is dropped up to the closing tag
+			closing := strings.Index(strings.ToLower(text[i:]), "</"+name)
+			if closing < 0 {
+				break
+			}
+			i += closing
+			if end = strings.IndexByte(text[i:], '>'); end < 0 {
+				break
+			}
+			i += end + 1
+		}
+
+		if _, inline := inlineTags[name]; !inline {
+			b.WriteByte(' ')
+		}
+	}
+
+	return html.UnescapeString(b.String())
+}
+
+// tagName returns the lowercase name of the tag whose content, between < and
+// >, is tag.
+func tagName(tag string) string {
+	tag = strings.TrimPrefix(tag, "/")
+	end := strings.IndexFunc(tag, func(c rune) bool { return unicode.IsSpace(c) || c == '/' })
+	if end >= 0 {
+		tag = tag[:end]
+	}
+	return strings.ToLower(tag)
+}
+
+// NormalizeFilter puts a text in a Unicode normalization form, NFC for the
+// zero value. NFKC also folds compatibility characters like full width
+// letters and ligatures.
+type NormalizeFilter struct {
+	Form norm.Form
+}
+
+func (f NormalizeFilter) Filter(text string) string {
+	return f.Form.String(text)
+}
+
+// LowercaseFilter lowers the case of the tokens.
+type LowercaseFilter struct{}
+
+func (LowercaseFilter) Filter(tokens []Token) []Token {
+	for k := range tokens {
+		tokens[k].Term = strings.ToLower(tokens[k].Term)
+	}
+	return tokens
+}
+
+// StopFilter drops the tokens in Words.
+type StopFilter struct {
+	Words map[string]struct{}
+}
+
+func NewStopFilter(words ...string) StopFilter {
+	f := StopFilter{Words: make(map[string]struct{}, len(words))}
+	for _, w := range words {
+		f.Words[w] = struct{}{}
+	}
+	return f
+}
+
+func (f StopFilter) Filter(tokens []Token) []Token {
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if _, exist := f.Words[token.Term]; !exist {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+// LengthFilter drops the tokens shorter than Min or longer than Max
+// characters. Max 0 is no limit.
+type LengthFilter struct {
+	Min int
+	Max int
+}
+
+func (f LengthFilter) Filter(tokens []Token) []Token {
+	kept := tokens[:0]
+	for _, token := range tokens {
+		l := utf8.RuneCountInString(token.Term)
+		if l >= f.Min && (f.Max == 0 || l <= f.Max) {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+// ASCIIFoldingFilter replaces the accented letters of the tokens by their
+// ASCII letters, like é by e and ß by ss.
+type ASCIIFoldingFilter struct{}
+
+// foldings are the letters that do not decompose into an ASCII letter and marks.
+var foldings = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'ø': "o", 'Ø': "O", 'œ': "oe", 'Œ': "OE",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th",
+	'Þ': "TH", 'ı': "i", 'ĸ': "k", 'ŉ': "n", 'ſ': "s", 'ŧ': "t", 'Ŧ': "T",
+}
+
+func (ASCIIFoldingFilter) Filter(tokens []Token) []Token {
+	for k := range tokens {
+		tokens[k].Term = fold(tokens[k].Term)
+	}
+	return tokens
+}
+
+func fold(term string) string {
+	ascii := true
+	for i := 0; i < len(term) && ascii; i++ {
+		ascii = term[i] < utf8.RuneSelf
+	}
+	if ascii {
+		return term
+	}
+
+	var b strings.Builder
+	for _, c := range norm.NFD.String(term) {
+		if unicode.Is(unicode.Mn, c) {
+			continue
+		}
+		if s, exist := foldings[c]; exist {
+			b.WriteString(s)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// StemFilter reduces the tokens to their stem with Stemmer, the Porter
+// stemmer for English when nil. Tokens are expected in lowercase.
+type StemFilter struct {
+	Stemmer func(string) string
+}
+
+func (f StemFilter) Filter(tokens []Token) []Token {
+	stemmer := f.Stemmer
+	if stemmer == nil {
+		stemmer = stem.Porter
+	}
+	for k := range tokens {
+		tokens[k].Term = stemmer(tokens[k].Term)
+	}
+	return tokens
+}
+
+// SynonymFilter adds the synonyms of a token after it, at the same position,
+// so a query for any of them matches the others.
+type SynonymFilter struct {
+	synonyms map[string][]string
+}
+
+// NewSynonymFilter makes the terms of every group synonyms of each other.
+func NewSynonymFilter(groups ...[]string) *SynonymFilter {
+	f := &SynonymFilter{synonyms: make(map[string][]string)}
+	for _, group := range groups {
+		for _, term := range group {
+			for _, synonym := range group {
+				if synonym != term && !contains(f.synonyms[term], synonym) {
+					f.synonyms[term] = append(f.synonyms[term], synonym)
+				}
+			}
+		}
+	}
+	return f
+}
+
+func (f *SynonymFilter) Filter(tokens []Token) []Token {
+	var out []Token
+	for k, token := range tokens {
+		synonyms, exist := f.synonyms[token.Term]
+		if !exist {
+			if out != nil {
+				out = append(out, token)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]Token, 0, len(tokens)+len(synonyms)), tokens[:k]...)
+		}
+		out = append(out, token)
+		for _, synonym := range synonyms {
+			s := token
+			s.Term = synonym
+			out = append(out, s)
+		}
+	}
+	if out == nil {
+		return tokens
+	}
+	return out
+}
+
+func contains(terms []string, term string) bool {
+	for _, t := range terms {
+		if t == term {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"golang.org/x/text/unicode/norm"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analyzer := &Analyzer{
+		CharFilters: []CharFilter{HTMLStripFilter{}, NormalizeFilter{Form: norm.NFKC}},
+		Tokenizer:   &seg.EnTokenizer{},
+		TokenFilters: []TokenFilter{
+			LowercaseFilter{},
+			ASCIIFoldingFilter{},
+			NewStopFilter("the"),
+			LengthFilter{Min: 2},
+			StemFilter{},
+			NewSynonymFilter([]string{"car", "automobil"}),
+		},
+	}
+
+	text, tokens, n := analyzer.analyze("<p>The Café</p><script>x()</script><b>Ca</b>rs &amp; a Straße")
+	if text != " The Café  Cars & a Straße" || n != 6 {
+		t.Fatalf("filtered %q, %d positions", text, n)
+	}
+
+	want := []Token{
+		{"cafe", 1, 5, 10},
+		{"car", 2, 12, 16},
+		{"automobil", 2, 12, 16},
+		{"strass", 5, 21, 28},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("tokens %+v", tokens)
+	}
+
+	if term, ok := analyzer.normalize("Running"); !ok || term != "run" {
+		t.Fatalf("normalize %q %v", term, ok)
+	}
+	if _, ok := analyzer.normalize("The"); ok {
+		t.Fatal("stop word normalized")
+	}
+}
+
+func TestFulltextAnalyzer(t *testing.T) {
+	index := "analyzer"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	if err = fulltext.PutMapping(index, Mapping{Fields: map[string]FieldMapping{"body": {Analyzer: "html"}}}); err == nil {
+		t.Fatal("unknown analyzer mapped")
+	}
+
+	err = fulltext.RegisterAnalyzer("html", &Analyzer{
+		CharFilters:  []CharFilter{HTMLStripFilter{}},
+		TokenFilters: []TokenFilter{LowercaseFilter{}, StemFilter{}, NewSynonymFilter([]string{"car", "automobil"})},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = fulltext.PutMapping(index, Mapping{Source: true, Fields: map[string]FieldMapping{"body": {Analyzer: "html"}}}); err != nil {
+		log.Fatal(err)
+	}
+	if err = fulltext.PutMapping(index, Mapping{Fields: map[string]FieldMapping{"body": {}}}); err == nil {
+		t.Fatal("analyzer changed")
+	}
+
+	err = fulltext.AddDocuments(index,
+		NewDocument("document_0").Add("title", "Running").Add("body", "<p>The dog was <b>running</b> after the <i>Cars</i></p>"),
+		NewDocument("document_1").Add("title", "running").Add("body", "<p>An automobile</p>"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	search := func(query *Query) []string {
+		hits, err := fulltext.Search(query.Index(index))
+		if err != nil {
+			log.Fatal(err)
+		}
+		var ids []string
+		for _, doc := range hits.Docs {
+			ids = append(ids, doc.ID)
+		}
+		return ids
+	}
+
+	// the body is stemmed and lowercased at index and query time, the title
+	// keeps the default analyzer
+	if ids := search(new(Query).Match("Runs").Fields("body")); !reflect.DeepEqual(ids, []string{"document_0"}) {
+		t.Fatalf("match body: %v", ids)
+	}
+	if ids := search(new(Query).Match("Running").Fields("title")); !reflect.DeepEqual(ids, []string{"document_0"}) {
+		t.Fatalf("match title: %v", ids)
+	}
+	if ids := search(new(Query).Match("car")); len(ids) != 2 {
+		t.Fatalf("synonyms: %v", ids)
+	}
+	if ids := search(new(Query).Must("Runs").Match("car")); !reflect.DeepEqual(ids, []string{"document_0"}) {
+		t.Fatalf("must: %v", ids)
+	}
+	if ids := search(new(Query).Phrase("was RUNNING after")); !reflect.DeepEqual(ids, []string{"document_0"}) {
+		t.Fatalf("phrase: %v", ids)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("run").Fields("body").Highlight(nil, "body"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(hits.Docs) != 1 || !reflect.DeepEqual(hits.Docs[0].Highlights["body"], []string{"The dog was <em>running</em> after the Cars"}) {
+		t.Fatalf("highlights: %+v", hits.Docs)
+	}
+}
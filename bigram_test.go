@@ -0,0 +1,47 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"testing"
+)
+
+// TestFulltextBigram needs no dictionary, unlike TestFulltextCh, and its file
+// comes first so that it runs even when TestFulltextCh cannot.
+func TestFulltextBigram(t *testing.T) {
+	index := "bigram"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.BigramTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	docs := map[string]string{
+		"document_0": "在信息检索中，BM25 是搜索引擎的排序函数",
+		"document_1": "信息的检索和索引",
+	}
+	if err = fulltext.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Phrase("信息检索").Highlight(nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 1 || hits.Docs[0].ID != "document_0" {
+		t.Fatalf("phrase: %+v", hits.Docs)
+	}
+
+	hits, err = fulltext.Search(new(Query).Index(index).Match("检索 bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 2 || hits.Docs[0].ID != "document_0" {
+		t.Fatalf("match: %+v", hits.Docs)
+	}
+
+	frags := fulltext.Highlight(docs["document_0"], "搜索引擎", nil)
+	if len(frags) != 1 || frags[0] != "在信息检索中，BM25 是<em>搜索引擎</em>的排序函数" {
+		t.Fatalf("highlight: %q", frags)
+	}
+}
@@ -0,0 +1,351 @@
+package fulltext
+
+import (
+	"errors"
+)
+
+// analyseChunk is the number of documents analysed in parallel at a time.
+const analyseChunk = 256
+
+var errBulkClosed = errors.New("fulltext/bulk: indexer closed")
+
+// BulkOptions configure a BulkIndexer. Zero values take the defaults.
+type BulkOptions struct {
+	// FlushDocs is the number of buffered documents that triggers a flush,
+	// 10000 by default.
+	FlushDocs int
+	// FlushBytes is the estimated memory of the buffered changes that
+	// triggers a flush, 64MB by default.
+	FlushBytes int
+	// OnError receives the documents that cannot be indexed. They are
+	// skipped and the others are indexed.
+	OnError func(id string, err error)
+	// OnProgress is called after every flush.
+	OnProgress func(BulkStats)
+}
+
+type BulkStats struct {
+	// Indexed and Deleted count the documents added or replaced and removed.
+	Indexed int
+	Deleted int
+	Failed  int
+	// Flushed counts the documents written so far, in Flushes batches.
+	Flushed int
+	Flushes int
+}
+
+// BulkIndexer loads any number of documents into an index. The statistics
+// of the documents are merged in memory and written in large batches, so a
+// token's postings and counts are read and written once per flush instead
+// of once per call. The indexer holds the write lock of the index until it is
+// closed: other writes to the index wait for Close. An indexer is not safe
+// for concurrent use.
+type BulkIndexer struct {
+	fulltext *Fulltext
+	index    string
+	opts     BulkOptions
+	mapping  *Mapping
+
+	c *change
+	// pending are the ids the buffered change touches. A document seen
+	// again is only indexed after a flush, as replacing it reads the stored one.
+	pending map[string]struct{}
+	docs    []*Document
+	bytes   int
+	stats   BulkStats
+	err     error
+	closed  bool
+	unlock  func()
+}
+
+func (fulltext *Fulltext) NewBulkIndexer(index string, opts *BulkOptions) (*BulkIndexer, error) {
+	b := &BulkIndexer{fulltext: fulltext, index: index}
+	if opts != nil {
+		b.opts = *opts
+	}
+	if b.opts.FlushDocs <= 0 {
+		b.opts.FlushDocs = 10000
+	}
+	if b.opts.FlushBytes <= 0 {
+		b.opts.FlushBytes = 64 << 20
+	}
+
+	b.unlock = fulltext.lock(index)
+
+	r := reader{fulltext.db}
+	mapping, err := r.mapping(index)
+	if err != nil {
+		b.unlock()
+		return nil, err
+	}
+	b.mapping = mapping
+
+	if err = b.reset(); err != nil {
+		b.unlock()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *BulkIndexer) reset() error {
+	c, err := newChange(reader{b.fulltext.db}, b.index)
+	if err != nil {
+		return err
+	}
+
+	b.c = c
+	b.pending = make(map[string]struct{})
+	b.bytes = 0
+	return nil
+}
+
+// Add buffers docs. They are indexed, and replace the indexed documents with
+// the same ids, by the flushes.
+func (b *BulkIndexer) Add(docs ...*Document) error {
+	if err := b.check(); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		b.docs = append(b.docs, doc)
+		if len(b.docs) >= analyseChunk {
+			if err := b.apply(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddChan adds the documents received from ch until it is closed. It stops
+// reading on the first error.
+func (b *BulkIndexer) AddChan(ch <-chan *Document) error {
+	for doc := range ch {
+		if err := b.Add(doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddIter adds the documents next returns until it reports there are no more.
+func (b *BulkIndexer) AddIter(next func() (*Document, bool)) error {
+	for {
+		doc, ok := next()
+		if !ok {
+			return nil
+		}
+		if err := b.Add(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// Delete removes documents by id, after the documents added before.
+func (b *BulkIndexer) Delete(ids ...string) error {
+	if err := b.check(); err != nil {
+		return err
+	}
+	if err := b.apply(); err != nil {
+		return err
+	}
+
+	r := reader{b.fulltext.db}
+	for _, id := range ids {
+		if _, exist := b.pending[id]; exist {
+			if err := b.flush(false); err != nil {
+				return err
+			}
+		}
+
+		ok, doc, err := r.docT(b.index, id)
+		if err != nil {
+			return b.fail(err)
+		}
+		if !ok {
+			continue
+		}
+
+		if err = b.c.remove(doc); err != nil {
+			return b.fail(err)
+		}
+		b.pending[id] = struct{}{}
+		b.stats.Deleted++
+
+		if err = b.maybeFlush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Flush writes the buffered documents.
+func (b *BulkIndexer) Flush() error {
+	if err := b.check(); err != nil {
+		return err
+	}
+	if err := b.apply(); err != nil {
+		return err
+	}
+
+	return b.flush(false)
+}
+
+// Close flushes the buffered documents and returns once everything the
+// indexer wrote is durable. It releases the index even when it fails, the
+// buffered documents are lost then.
+func (b *BulkIndexer) Close() error {
+	if err := b.check(); err != nil {
+		if !b.closed {
+			b.closed = true
+			b.unlock()
+		}
+		return err
+	}
+	defer b.unlock()
+	b.closed = true
+
+	if err := b.apply(); err != nil {
+		return err
+	}
+
+	return b.flush(true)
+}
+
+func (b *BulkIndexer) Stats() BulkStats {
+	return b.stats
+}
+
+func (b *BulkIndexer) check() error {
+	if b.closed {
+		return errBulkClosed
+	}
+	return b.err
+}
+
+// fail stops the indexer: the buffered change is only partly applied.
+func (b *BulkIndexer) fail(err error) error {
+	b.err = err
+	return err
+}
+
+// apply analyses the waiting documents and merges them into the change.
+func (b *BulkIndexer) apply() error {
+	docs := make([]*Document, 0, len(b.docs))
+	for _, doc := range b.docs {
+		if err := checkDoc(doc); err != nil {
+			b.stats.Failed++
+			if b.opts.OnError != nil {
+				var id string
+				if doc != nil {
+					id = doc.ID
+				}
+				b.opts.OnError(id, err)
+			}
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	b.docs = b.docs[:0]
+	if len(docs) == 0 {
+		return nil
+	}
+
+	if newMapping := dynamicMapping(b.mapping, docs); newMapping != nil {
+		b.mapping = newMapping
+		b.c.mapping = newMapping
+	}
+
+	docsMeta, err := b.fulltext.analyseDocs(b.mapping, docs)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	for k, meta := range docsMeta {
+		if _, exist := b.pending[meta.id]; exist {
+			if err := b.flush(false); err != nil {
+				return err
+			}
+		}
+
+		if err := b.c.loadFree(len(docs) - k); err != nil {
+			return b.fail(err)
+		}
+		if err := b.c.index(meta); err != nil {
+			return b.fail(err)
+		}
+		b.pending[meta.id] = struct{}{}
+		b.bytes += meta.size()
+		b.stats.Indexed++
+
+		if err := b.maybeFlush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *BulkIndexer) maybeFlush() error {
+	if len(b.pending) < b.opts.FlushDocs && b.bytes < b.opts.FlushBytes {
+		return nil
+	}
+	return b.flush(false)
+}
+
+// flush writes the change in one batch and starts a new one.
+func (b *BulkIndexer) flush(sync bool) error {
+	if len(b.pending) == 0 && !sync {
+		return nil
+	}
+
+	batch, err := b.fulltext.metaBatch(b.index, b.c)
+	if err != nil {
+		return b.fail(err)
+	}
+	if sync {
+		err = b.fulltext.db.WriteSync(batch)
+	} else {
+		err = b.fulltext.db.Write(batch)
+	}
+	if err != nil {
+		return b.fail(err)
+	}
+
+	flushed := len(b.pending)
+	if err = b.reset(); err != nil {
+		return b.fail(err)
+	}
+	if flushed == 0 {
+		return nil
+	}
+
+	b.stats.Flushed += flushed
+	b.stats.Flushes++
+	if b.opts.OnProgress != nil {
+		b.opts.OnProgress(b.stats)
+	}
+
+	return nil
+}
+
+// size estimates the memory a document takes in a change.
+func (meta docMeta) size() int {
+	n := len(meta.id)
+	for field, fm := range meta.fields {
+		for token, pos := range fm.pos {
+			n += 2*(len(field)+len(token)) + 48 + 4*len(pos)
+		}
+	}
+	for field, values := range meta.src {
+		n += len(field)
+		for _, value := range values {
+			n += len(value)
+		}
+	}
+	return n
+}
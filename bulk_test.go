@@ -0,0 +1,116 @@
+package fulltext
+
+import (
+	"fmt"
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"testing"
+)
+
+func TestBulkIndexer(t *testing.T) {
+	index := "bulk"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	var failed []string
+	var progress []BulkStats
+	bulk, err := fulltext.NewBulkIndexer(index, &BulkOptions{
+		FlushDocs:  1000,
+		OnError:    func(id string, err error) { failed = append(failed, id) },
+		OnProgress: func(stats BulkStats) { progress = append(progress, stats) },
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ch := make(chan *Document)
+	go func() {
+		for n := 0; n < 5000; n++ {
+			text := "okapi"
+			if n%10 == 0 {
+				text += " bm25"
+			}
+			ch <- NewDocument(fmt.Sprintf("document_%04d", n)).Add("body", text)
+		}
+		ch <- NewDocument("bad").Add("a:b", "okapi")
+		// replaces a document still buffered
+		ch <- NewDocument("document_4999").Add("body", "bm25 bm25")
+		close(ch)
+	}()
+	if err = bulk.AddChan(ch); err != nil {
+		log.Fatal(err)
+	}
+	if err = bulk.Delete("document_0000", "document_0001"); err != nil {
+		log.Fatal(err)
+	}
+	if err = bulk.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err = bulk.Add(NewDocument("late")); err != errBulkClosed {
+		t.Fatalf("add after close: %v", err)
+	}
+
+	stats := bulk.Stats()
+	if stats.Indexed != 5001 || stats.Deleted != 2 || stats.Failed != 1 || stats.Flushed != 5003 {
+		t.Fatalf("stats: %+v", stats)
+	}
+	if len(failed) != 1 || failed[0] != "bad" {
+		t.Fatalf("failed: %v", failed)
+	}
+	if len(progress) < 5 || progress[len(progress)-1] != stats {
+		t.Fatalf("progress: %v", progress)
+	}
+
+	r := reader{fulltext.db}
+	if ds, err := r.ds(index); err != nil || ds != 4998 {
+		t.Fatalf("ds: %d %v", ds, err)
+	}
+	if idf, err := r.idf(index, "body", "bm25"); err != nil || idf != 500 {
+		t.Fatalf("idf: %d %v", idf, err)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 500 || hits.Docs[0].ID != "document_4999" {
+		t.Fatalf("hits: %d %+v", hits.Total, hits.Docs)
+	}
+
+	// the same documents added in batches score the same
+	other, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer other.Free()
+	for n := 0; n < 5000; n += 1000 {
+		var docs []*Document
+		for k := n; k < n+1000; k++ {
+			if k < 2 {
+				continue
+			}
+			text := "okapi"
+			if k%10 == 0 {
+				text += " bm25"
+			}
+			if k == 4999 {
+				text = "bm25 bm25"
+			}
+			docs = append(docs, NewDocument(fmt.Sprintf("document_%04d", k)).Add("body", text))
+		}
+		if err = other.AddDocuments(index, docs...); err != nil {
+			log.Fatal(err)
+		}
+	}
+	want, err := other.Search(new(Query).Index(index).Match("bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if want.Total != hits.Total || want.Docs[0].Score != hits.Docs[0].Score || want.Docs[1].Score != hits.Docs[1].Score {
+		t.Fatalf("bulk %+v, batches %+v", hits.Docs[:2], want.Docs[:2])
+	}
+}
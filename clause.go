@@ -0,0 +1,701 @@
+package fulltext
+
+import (
+	"golang.org/x/sync/errgroup"
+	"strconv"
+	"strings"
+)
+
+// Clause is a node of a query tree, given to Query.Clause. The documents a
+// clause matches are scored by the similarity of the index times its boost,
+// 1 when 0. A Query is a clause too, boosted by Query.Boost.
+type Clause interface {
+	// eval returns the scores of the documents the clause matches, nil when
+	// it has no term at all, e.g. only stop words, and is left out.
+	eval(e *executor) (map[uint32]float32, error)
+}
+
+// BoolClause combines clauses. A document matches when it matches every Must
+// and Filter clause, none of the MustNot ones and at least MinimumShouldMatch
+// of the Should ones, at least one when there is no Must or Filter clause.
+// It scores the sum of the scores of the Must and Should clauses it matches,
+// the Filter clauses are not scored at all. A BoolClause with only MustNot
+// clauses matches nothing.
+type BoolClause struct {
+	Must    []Clause
+	Filter  []Clause
+	Should  []Clause
+	MustNot []Clause
+	// MinimumShouldMatch below 0 is the number of Should clauses a document
+	// may miss.
+	MinimumShouldMatch int
+	Boost              float32
+}
+
+// MatchClause matches the documents holding any token of Text, analysed
+// like the searched fields, or every token with RequireAll. A keyword field
+// holds Text as is.
+type MatchClause struct {
+	Text string
+	// Fields are the searched fields, the ones of the query when empty.
+	Fields []string
+	// Fuzziness also matches the terms within these edits of the tokens, as
+	// Query.Fuzziness does.
+	Fuzziness  int
+	RequireAll bool
+	Boost      float32
+}
+
+// TermClause matches the documents holding Value, as is, in Field.
+type TermClause struct {
+	Field string
+	Value string
+	Boost float32
+}
+
+// PhraseClause matches the documents holding the tokens of Text next to
+// each other and in order. With Slop, or Terms given as is instead of Text,
+// the tokens may be in any order within a window of Slop positions more than
+// the tokens, like Query.Near.
+type PhraseClause struct {
+	Text   string
+	Terms  []string
+	Slop   int
+	Fields []string
+	Boost  float32
+}
+
+// PrefixClause matches the terms starting with Prefix, like Query.Prefix.
+type PrefixClause struct {
+	Prefix string
+	Fields []string
+	Boost  float32
+	// analyzed has the literal parts analysed, see multiTerm.analyzed
+	analyzed bool
+}
+
+// WildcardClause matches the terms of Pattern, like Query.Wildcard.
+type WildcardClause struct {
+	Pattern  string
+	Fields   []string
+	Boost    float32
+	analyzed bool
+}
+
+// RegexpClause matches the terms of Expr, like Query.Regexp.
+type RegexpClause struct {
+	Expr     string
+	Fields   []string
+	Boost    float32
+	analyzed bool
+}
+
+// FuzzyClause matches the terms within Edits of Term, like Query.Fuzzy.
+type FuzzyClause struct {
+	Term   string
+	Edits  int
+	Fields []string
+	Boost  float32
+}
+
+// RangeClause matches the documents holding a term of Field within the
+// bounds, the empty ones being left out. When every bound is a number the
+// terms are compared as numbers, and the terms that are not are left out,
+// else they are compared as strings. Every matching document scores the
+// boost.
+type RangeClause struct {
+	Field string
+	Gt    string
+	Gte   string
+	Lt    string
+	Lte   string
+	Boost float32
+}
+
+// tokenClause matches a token the query gives as is, normalized by the
+// analyzer of the searched fields.
+type tokenClause struct {
+	token  string
+	fields []string
+	boost  float32
+	// match is the Match of the query. When it already scores the token, a
+	// must token only filters and a should one is left out.
+	match *MatchClause
+	must  bool
+}
+
+// executor evaluates a query tree against one index.
+type executor struct {
+	fulltext   *Fulltext
+	r          reader
+	i          string
+	mapping    *Mapping
+	settings   *Settings
+	similarity Similarity
+	query      *Query
+	// fields are searched by the clauses that name none
+	fields []string
+	// filter only tells which documents match, without scoring them
+	filter     bool
+	explaining *explaining
+}
+
+func (e *executor) groups(fields []string) ([]fieldGroup, error) {
+	if len(fields) == 0 {
+		fields = e.fields
+	}
+	return e.fulltext.fieldGroups(e.mapping, fields)
+}
+
+func (e *executor) searched(fields []string) []string {
+	if len(fields) == 0 {
+		return e.fields
+	}
+	return fields
+}
+
+// filtering returns the executor of the clauses that are not scored.
+func (e *executor) filtering() *executor {
+	if e.filter {
+		return e
+	}
+	filter := *e
+	filter.filter = true
+	return &filter
+}
+
+// score scores the postings times boost.
+func (e *executor) score(tfidfs []tokenTFIDF, boost float32) (map[uint32]float32, error) {
+	if len(tfidfs) == 0 {
+		return make(map[uint32]float32), nil
+	}
+	var scores map[uint32]float32
+	if e.filter {
+		scores = make(map[uint32]float32)
+		for _, tfidf := range tfidfs {
+			for num := range tfidf.tokenTF {
+				scores[num] = 0
+			}
+		}
+	} else {
+		var err error
+		if scores, err = e.fulltext.score(e.r, e.i, e.mapping, e.similarity, tfidfs); err != nil {
+			return nil, err
+		}
+		if boost != 0 && boost != 1 {
+			for num := range scores {
+				scores[num] *= boost
+			}
+		}
+	}
+
+	if e.explaining != nil {
+		if err := e.explainScores(tfidfs, boost, scores); err != nil {
+			return nil, err
+		}
+	}
+	return scores, nil
+}
+
+func (c *BoolClause) eval(e *executor) (map[uint32]float32, error) {
+	filter := e.filtering()
+	// the explanations of the clauses the documents match
+	var explained map[uint32][]Explanation
+	if e.explaining != nil {
+		explained = make(map[uint32][]Explanation)
+	}
+	explain := func(explanations map[uint32]*Explanation) {
+		for num, explanation := range explanations {
+			explained[num] = append(explained[num], *explanation)
+		}
+	}
+
+	var scores map[uint32]float32
+	required := append(c.Must[:len(c.Must):len(c.Must)], c.Filter...)
+	for k, clause := range required {
+		by := e
+		if k >= len(c.Must) {
+			by = filter
+		}
+		clauseScores, explanations, err := by.eval(clause)
+		if err != nil {
+			return nil, err
+		}
+		if clauseScores == nil {
+			continue
+		}
+		explain(explanations)
+		if scores == nil {
+			scores = clauseScores
+			continue
+		}
+		for num, score := range scores {
+			if clauseScore, exist := clauseScores[num]; exist {
+				scores[num] = score + clauseScore
+			} else {
+				delete(scores, num)
+			}
+		}
+	}
+
+	var should int
+	matched := make(map[uint32]int)
+	shouldScores := make(map[uint32]float32)
+	for _, clause := range c.Should {
+		clauseScores, explanations, err := e.eval(clause)
+		if err != nil {
+			return nil, err
+		}
+		if clauseScores == nil {
+			continue
+		}
+		explain(explanations)
+		should++
+		for num, score := range clauseScores {
+			matched[num]++
+			shouldScores[num] += score
+		}
+	}
+
+	min := c.MinimumShouldMatch
+	if min < 0 {
+		min += should
+		if min < 0 {
+			min = 0
+		}
+	}
+	if scores == nil {
+		if should == 0 {
+			return nil, nil
+		}
+		if min < 1 {
+			min = 1
+		}
+		scores = make(map[uint32]float32)
+		for num, n := range matched {
+			if n >= min {
+				scores[num] = shouldScores[num]
+			}
+		}
+	} else {
+		for num := range scores {
+			if matched[num] < min {
+				delete(scores, num)
+				continue
+			}
+			scores[num] += shouldScores[num]
+		}
+	}
+
+	for _, clause := range c.MustNot {
+		clauseScores, _, err := filter.eval(clause)
+		if err != nil {
+			return nil, err
+		}
+		for num := range clauseScores {
+			delete(scores, num)
+		}
+	}
+
+	if c.Boost != 0 && c.Boost != 1 {
+		for num := range scores {
+			scores[num] *= c.Boost
+		}
+	}
+
+	if e.explaining != nil {
+		last := make(map[uint32]*Explanation)
+		for num := range scores {
+			if _, exist := e.explaining.nums[num]; !exist {
+				continue
+			}
+			explanation := &Explanation{Description: "sum of the matching clauses", Details: explained[num]}
+			if c.Boost != 0 && c.Boost != 1 {
+				explanation.Description = "sum of the matching clauses times boost"
+				explanation.Details = append(explanation.Details, Explanation{Value: c.Boost, Description: "boost of the clause"})
+			}
+			last[num] = explanation
+		}
+		e.explaining.last = last
+	}
+	return scores, nil
+}
+
+func (c *MatchClause) eval(e *executor) (map[uint32]float32, error) {
+	var text, keywords []string
+	for _, field := range e.searched(c.Fields) {
+		if e.mapping.field(field).Type == FieldKeyword {
+			keywords = append(keywords, field)
+		} else {
+			text = append(text, field)
+		}
+	}
+	groups, err := e.fulltext.fieldGroups(e.mapping, text)
+	if err != nil {
+		return nil, err
+	}
+
+	// the tokens of Text in every group of fields
+	type analysed struct {
+		fields []string
+		tokens []string
+	}
+	sets := make([]analysed, 0, len(groups)+1)
+	for _, group := range groups {
+		sets = append(sets, analysed{group.fields, group.analyzer.terms(c.Text)})
+	}
+	if len(keywords) != 0 && c.Text != "" {
+		sets = append(sets, analysed{keywords, []string{c.Text}})
+	}
+
+	var eg errgroup.Group
+	loaded := make([][][]tokenTFIDF, len(sets))
+	for k, set := range sets {
+		k, set := k, set
+		loaded[k] = make([][]tokenTFIDF, len(set.tokens))
+
+		for n, token := range set.tokens {
+			n, token := n, token
+
+			eg.Go(func() (err error) {
+				loaded[k][n], err = fuzzyTF(e.r, e.i, set.fields, token, c.Fuzziness, e.query)
+				return err
+			})
+		}
+	}
+	if err = eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	var tfidfs []tokenTFIDF
+	// the documents holding every token of some group
+	all := make(map[uint32]struct{})
+	analysedAny := false
+	for k, set := range sets {
+		if len(set.tokens) == 0 {
+			continue
+		}
+		analysedAny = true
+
+		var docs map[uint32]struct{}
+		for n := range set.tokens {
+			tf := make(map[uint32]struct{})
+			for _, tfidf := range loaded[k][n] {
+				tfidfs = append(tfidfs, tfidf)
+				for num := range tfidf.tokenTF {
+					tf[num] = struct{}{}
+				}
+			}
+			if docs == nil {
+				docs = tf
+				continue
+			}
+			for num := range docs {
+				if _, exist := tf[num]; !exist {
+					delete(docs, num)
+				}
+			}
+		}
+		for num := range docs {
+			all[num] = struct{}{}
+		}
+	}
+	if !analysedAny {
+		return nil, nil
+	}
+
+	scores, err := e.score(tfidfs, c.Boost)
+	if err != nil || !c.RequireAll {
+		return scores, err
+	}
+	for num := range scores {
+		if _, exist := all[num]; !exist {
+			delete(scores, num)
+		}
+	}
+	return scores, nil
+}
+
+func (c *tokenClause) eval(e *executor) (map[uint32]float32, error) {
+	groups, err := e.groups(c.fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.match != nil && c.matched(groups) {
+		if !c.must {
+			return nil, nil
+		}
+		// the token is still required as is, whatever the fuzziness of Match
+		e = e.filtering()
+	}
+
+	var tfidfs []tokenTFIDF
+	normalized := false
+	for _, group := range groups {
+		token, ok := group.analyzer.normalize(c.token)
+		if !ok {
+			continue
+		}
+		normalized = true
+
+		tfidf, err := termTF(e.r, e.i, group.fields, token)
+		if err != nil {
+			return nil, err
+		}
+		if tfidf != nil {
+			tfidfs = append(tfidfs, *tfidf)
+		}
+	}
+	if !normalized {
+		return nil, nil
+	}
+
+	return e.score(tfidfs, c.boost)
+}
+
+// matched tells whether the Match of the query has the token in some group
+// of fields.
+func (c *tokenClause) matched(groups []fieldGroup) bool {
+	for _, group := range groups {
+		token, ok := group.analyzer.normalize(c.token)
+		if !ok {
+			continue
+		}
+		for _, term := range group.analyzer.terms(c.match.Text) {
+			if term == token {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *TermClause) eval(e *executor) (map[uint32]float32, error) {
+	tfidf, err := termTF(e.r, e.i, []string{c.Field}, c.Value)
+	if err != nil || tfidf == nil {
+		return make(map[uint32]float32), err
+	}
+
+	return e.score([]tokenTFIDF{*tfidf}, c.Boost)
+}
+
+func (c *PhraseClause) eval(e *executor) (map[uint32]float32, error) {
+	groups, err := e.groups(c.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	tfidf, err := phraseTF(e.r, e.i, groups, phrase{text: c.Text, terms: c.Terms, slop: c.Slop})
+	if err != nil || tfidf == nil {
+		return nil, err
+	}
+
+	return e.score([]tokenTFIDF{*tfidf}, c.Boost)
+}
+
+// multiTerm matches m in fields. Analyzed, the pattern of the text fields is
+// analysed by their analyzer, the keywords are compared with it as is.
+func (e *executor) multiTerm(m multiTerm, fields []string, boost float32, analyzed bool) (map[uint32]float32, error) {
+	patterns := []multiTerm{m}
+	patternFields := map[multiTerm][]string{m: e.searched(fields)}
+	if analyzed {
+		var text []string
+		patternFields[m] = nil
+		for _, field := range e.searched(fields) {
+			if e.mapping.field(field).Type == FieldKeyword {
+				patternFields[m] = append(patternFields[m], field)
+			} else {
+				text = append(text, field)
+			}
+		}
+		groups, err := e.fulltext.fieldGroups(e.mapping, text)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			analyzedM := m.analyzed(group.analyzer)
+			if _, exist := patternFields[analyzedM]; !exist {
+				patterns = append(patterns, analyzedM)
+			}
+			patternFields[analyzedM] = append(patternFields[analyzedM], group.fields...)
+		}
+	}
+
+	var tfidfs []tokenTFIDF
+	for _, pattern := range patterns {
+		if len(patternFields[pattern]) == 0 {
+			continue
+		}
+		loaded, err := multiTermTF(e.r, e.i, patternFields[pattern], pattern, e.query.maxExpansions, e.query.expansionScoring)
+		if err != nil {
+			return nil, err
+		}
+		tfidfs = append(tfidfs, loaded...)
+	}
+
+	return e.score(tfidfs, boost)
+}
+
+func (c *PrefixClause) eval(e *executor) (map[uint32]float32, error) {
+	return e.multiTerm(multiTerm{prefixTerm, c.Prefix}, c.Fields, c.Boost, c.analyzed)
+}
+
+func (c *WildcardClause) eval(e *executor) (map[uint32]float32, error) {
+	return e.multiTerm(multiTerm{wildcardTerm, c.Pattern}, c.Fields, c.Boost, c.analyzed)
+}
+
+func (c *RegexpClause) eval(e *executor) (map[uint32]float32, error) {
+	return e.multiTerm(multiTerm{regexpTerm, c.Expr}, c.Fields, c.Boost, c.analyzed)
+}
+
+func (c *FuzzyClause) eval(e *executor) (map[uint32]float32, error) {
+	tfidfs, err := fuzzyTF(e.r, e.i, e.searched(c.Fields), c.Term, c.Edits, e.query)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.score(tfidfs, c.Boost)
+}
+
+func (c *RangeClause) eval(e *executor) (map[uint32]float32, error) {
+	in := c.inString
+	if c.numeric() {
+		in = c.inNumber
+	}
+
+	tfidf := tokenTFIDF{term: describe(c), tokenTF: make(map[uint32]uint32), boost: 1, constant: true}
+	var terms []string
+	err := e.r.terms(e.i, c.Field, "", func(term string, df uint32) bool {
+		if in(term) {
+			terms = append(terms, term)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, term := range terms {
+		tf, err := e.r.tf(e.i, c.Field, term)
+		if err != nil {
+			return nil, err
+		}
+		for num, tfVal := range tf {
+			tfidf.tokenTF[num] += tfVal
+		}
+	}
+	tfidf.tokenIDF = uint32(len(tfidf.tokenTF))
+
+	return e.score([]tokenTFIDF{tfidf}, c.Boost)
+}
+
+func (c *RangeClause) numeric() bool {
+	numeric := false
+	for _, bound := range []string{c.Gt, c.Gte, c.Lt, c.Lte} {
+		if bound == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(bound, 64); err != nil {
+			return false
+		}
+		numeric = true
+	}
+	return numeric
+}
+
+func (c *RangeClause) inString(term string) bool {
+	return (c.Gt == "" || term > c.Gt) && (c.Gte == "" || term >= c.Gte) &&
+		(c.Lt == "" || term < c.Lt) && (c.Lte == "" || term <= c.Lte)
+}
+
+func (c *RangeClause) inNumber(term string) bool {
+	v, err := strconv.ParseFloat(term, 64)
+	if err != nil {
+		return false
+	}
+	bound := func(s string) float64 {
+		b, _ := strconv.ParseFloat(s, 64)
+		return b
+	}
+	return (c.Gt == "" || v > bound(c.Gt)) && (c.Gte == "" || v >= bound(c.Gte)) &&
+		(c.Lt == "" || v < bound(c.Lt)) && (c.Lte == "" || v <= bound(c.Lte))
+}
+
+// clause returns the query tree the builder methods describe: every clause
+// they require is a Must clause and the Match tokens, the Should tokens and
+// the phrase boost are Should clauses. It is nil for an empty query.
+func (query *Query) clause() Clause {
+	b := &BoolClause{}
+	var match *MatchClause
+	if query.match != "" {
+		match = &MatchClause{Text: query.match, Fields: query.fields, Fuzziness: query.fuzziness}
+		b.Should = append(b.Should, match)
+		if query.phraseBoost > 0 {
+			b.Should = append(b.Should, &PhraseClause{Text: query.match, Fields: query.fields, Boost: query.phraseBoost})
+		}
+	}
+	for _, occur := range []struct {
+		tokens  []string
+		clauses *[]Clause
+	}{{query.should, &b.Should}, {query.must, &b.Must}, {query.filter, &b.Filter}, {query.mustNot, &b.MustNot}} {
+		for _, str := range occur.tokens {
+			token, boost := tokenBoost(str)
+			c := &tokenClause{token: token, fields: query.fields, boost: boost, must: occur.clauses == &b.Must}
+			// a token with a boost of its own is scored again
+			if token == str && (occur.clauses == &b.Should || c.must) {
+				c.match = match
+			}
+			*occur.clauses = append(*occur.clauses, c)
+		}
+	}
+	for _, term := range query.terms {
+		b.Must = append(b.Must, &TermClause{Field: term.field, Value: term.token})
+	}
+	for _, ph := range query.phrases {
+		b.Must = append(b.Must, &PhraseClause{Text: ph.text, Terms: ph.terms, Slop: ph.slop, Fields: query.fields})
+	}
+	for _, m := range query.multiTerms {
+		switch m.kind {
+		case prefixTerm:
+			b.Must = append(b.Must, &PrefixClause{Prefix: m.pattern, Fields: query.fields})
+		case wildcardTerm:
+			b.Must = append(b.Must, &WildcardClause{Pattern: m.pattern, Fields: query.fields})
+		case regexpTerm:
+			b.Must = append(b.Must, &RegexpClause{Expr: m.pattern, Fields: query.fields})
+		}
+	}
+	for _, f := range query.fuzzies {
+		b.Must = append(b.Must, &FuzzyClause{Term: f.term, Edits: f.edits, Fields: query.fields})
+	}
+	b.Must = append(b.Must, query.clauses...)
+	b.Boost = query.boost
+
+	if len(b.Must) == 0 && len(b.Filter) == 0 && len(b.Should) == 0 {
+		return nil
+	}
+	return b
+}
+
+// eval makes a query the clause of another one. It searches its own fields,
+// the other options are the ones of the query searched.
+func (query *Query) eval(e *executor) (map[uint32]float32, error) {
+	clause := query.clause()
+	if clause == nil {
+		return nil, nil
+	}
+	return clause.eval(e)
+}
+
+// tokenBoost splits the boost off a token given as token^boost.
+func tokenBoost(str string) (string, float32) {
+	k := strings.LastIndexByte(str, '^')
+	if k <= 0 {
+		return str, 1
+	}
+	boost, err := strconv.ParseFloat(str[k+1:], 32)
+	if err != nil || boost <= 0 {
+		return str, 1
+	}
+	return str[:k], float32(boost)
+}
@@ -0,0 +1,228 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFulltextClause(t *testing.T) {
+	index := "clause"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.PutMapping(index, Mapping{Fields: map[string]FieldMapping{
+		"body":  {Type: FieldText},
+		"year":  {Type: FieldKeyword},
+		"genre": {Type: FieldKeyword},
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = fulltext.AddDocuments(index,
+		NewDocument("document_0").Add("body", "apple banana cherry").Add("year", "2009").Add("genre", "fiction"),
+		NewDocument("document_1").Add("body", "apple cherry date").Add("year", "2012").Add("genre", "history"),
+		NewDocument("document_2").Add("body", "banana date").Add("year", "998").Add("genre", "poetry"),
+		NewDocument("document_3").Add("body", "apple banana").Add("year", "2021").Add("genre", "fiction"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	search := func(query *Query) []Doc {
+		hits, err := fulltext.Search(query.Index(index))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return hits.Docs
+	}
+	ids := func(query *Query) []string {
+		var ids []string
+		for _, doc := range search(query) {
+			ids = append(ids, doc.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// (apple OR date) AND NOT (cherry AND banana)
+	tree := &BoolClause{
+		Should: []Clause{&MatchClause{Text: "apple"}, &MatchClause{Text: "date"}},
+		MustNot: []Clause{&BoolClause{
+			Must: []Clause{&MatchClause{Text: "cherry"}, &MatchClause{Text: "banana"}},
+		}},
+	}
+	if got := ids(new(Query).Clause(tree)); !reflect.DeepEqual(got, []string{"document_1", "document_2", "document_3"}) {
+		t.Fatalf("nested: %v", got)
+	}
+
+	tree = &BoolClause{
+		Should: []Clause{
+			&MatchClause{Text: "apple"}, &MatchClause{Text: "banana"}, &MatchClause{Text: "cherry"},
+		},
+		MinimumShouldMatch: 2,
+	}
+	if got := ids(new(Query).Clause(tree)); !reflect.DeepEqual(got, []string{"document_0", "document_1", "document_3"}) {
+		t.Fatalf("minimum should match: %v", got)
+	}
+	tree.MinimumShouldMatch = 0
+	tree.Must = []Clause{&TermClause{Field: "genre", Value: "fiction"}}
+	if got := ids(new(Query).Clause(tree)); !reflect.DeepEqual(got, []string{"document_0", "document_3"}) {
+		t.Fatalf("must: %v", got)
+	}
+
+	tree = &BoolClause{Should: []Clause{
+		&TermClause{Field: "genre", Value: "fiction"},
+		&TermClause{Field: "genre", Value: "poetry", Boost: 10},
+	}}
+	if docs := search(new(Query).Clause(tree)); len(docs) != 3 || docs[0].ID != "document_2" {
+		t.Fatalf("boost: %+v", docs)
+	}
+
+	if got := ids(new(Query).Clause(&RangeClause{Field: "year", Gte: "1000", Lt: "2012"})); !reflect.DeepEqual(got, []string{"document_0"}) {
+		t.Fatalf("numeric range: %v", got)
+	}
+	if got := ids(new(Query).Clause(&RangeClause{Field: "genre", Gt: "fiction", Lte: "poetry"})); !reflect.DeepEqual(got, []string{"document_1", "document_2"}) {
+		t.Fatalf("string range: %v", got)
+	}
+	if got := ids(new(Query).Clause(&PrefixClause{Prefix: "cher"}).MustNot("date")); !reflect.DeepEqual(got, []string{"document_0"}) {
+		t.Fatalf("prefix: %v", got)
+	}
+	if got := ids(new(Query).Clause(&PhraseClause{Text: "cherry apple", Slop: 1})); !reflect.DeepEqual(got, []string{"document_0", "document_1"}) {
+		t.Fatalf("sloppy phrase: %v", got)
+	}
+
+	// the builder methods add up
+	if got := ids(new(Query).Must("apple").Must("banana").MustNot("cherry")); !reflect.DeepEqual(got, []string{"document_3"}) {
+		t.Fatalf("builder: %v", got)
+	}
+}
+
+func TestFulltextBoost(t *testing.T) {
+	index := "boost"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	docs := map[string]string{
+		"document_0": "apple banana",
+		"document_1": "apple cherry",
+		"document_2": "banana cherry",
+	}
+	if err = fulltext.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+
+	search := func(query *Query) []Doc {
+		hits, err := fulltext.Search(query.Index(index))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return hits.Docs
+	}
+	ids := func(docs []Doc) []string {
+		var ids []string
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+		return ids
+	}
+
+	if got := ids(search(new(Query).Match("apple").Should("banana^10"))); !reflect.DeepEqual(got, []string{"document_0", "document_2", "document_1"}) {
+		t.Fatalf("token boost: %v", got)
+	}
+
+	tree := &BoolClause{Should: []Clause{new(Query).Match("apple"), new(Query).Match("cherry").Boost(5)}}
+	if got := ids(search(new(Query).Clause(tree))); !reflect.DeepEqual(got, []string{"document_1", "document_2", "document_0"}) {
+		t.Fatalf("query boost: %v", got)
+	}
+
+	filtered := search(new(Query).Match("cherry").Filter("apple"))
+	scored := search(new(Query).Match("cherry"))
+	// like with Must, Match only adds to the score
+	if len(filtered) != 2 || filtered[0].ID != "document_1" || filtered[1].Score != 0 {
+		t.Fatalf("filter: %+v", filtered)
+	}
+	for _, doc := range scored {
+		if doc.ID == "document_1" && doc.Score != filtered[0].Score {
+			t.Fatalf("filter scored: %v, want %v", filtered[0].Score, doc.Score)
+		}
+	}
+
+	for _, doc := range search(new(Query).Filter("banana")) {
+		if doc.Score != 0 {
+			t.Fatalf("filter only: %+v", doc)
+		}
+	}
+}
+
+// TestFulltextMatchTokens pins the scores Must and Should tokens got before
+// the query tree: a token Match already scores is not scored again, and a
+// Must token is required as is whatever the fuzziness of Match.
+func TestFulltextMatchTokens(t *testing.T) {
+	index := "tokens"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.AddDocs(index, map[string]string{
+		"document_0": "okapi bm25 ranking function",
+		"document_1": "okapi okapi bm25 ranking in the okapi system",
+		"document_2": "bm25 for lucene scoring",
+		"document_3": "okapo ranking",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scores := func(query *Query) map[string]float32 {
+		hits, err := fulltext.Search(query.Index(index))
+		if err != nil {
+			log.Fatal(err)
+		}
+		scores := make(map[string]float32)
+		for _, doc := range hits.Docs {
+			scores[doc.ID] = doc.Score
+		}
+		return scores
+	}
+
+	matched := map[string]float32{"document_0": 1.1034627, "document_1": 1.2227962, "document_2": 0.37489927}
+	for name, c := range map[string]struct {
+		query *Query
+		want  map[string]float32
+	}{
+		"must":         {new(Query).Match("okapi bm25").Must("bm25"), matched},
+		"should":       {new(Query).Match("okapi bm25").Should("bm25"), matched},
+		"must other":   {new(Query).Match("okapi").Must("bm25"), matched},
+		"should other": {new(Query).Match("okapi").Should("ranking"), map[string]float32{"document_0": 1.1034627, "document_1": 1.2227962, "document_3": 0.47120366}},
+		"fuzzy must":   {new(Query).Match("okapi ranking").Fuzziness(1).Must("okapi"), map[string]float32{"document_0": 1.1034627, "document_1": 1.2227962}},
+		"fuzzy other":  {new(Query).Match("ranking").Fuzziness(1).Must("okapi"), map[string]float32{"document_0": 1.1034627, "document_1": 1.2227962}},
+	} {
+		got := scores(c.query)
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: %v, want %v", name, got, c.want)
+		}
+		for id, score := range c.want {
+			if d := got[id] - score; d > 1e-5 || d < -1e-5 {
+				t.Fatalf("%s: %v, want %v", name, got, c.want)
+			}
+		}
+	}
+
+	// a token with a boost of its own is scored again
+	boosted := scores(new(Query).Match("okapi bm25").Should("bm25^2"))
+	if boosted["document_2"] <= matched["document_2"] {
+		t.Fatalf("boosted: %v", boosted)
+	}
+}
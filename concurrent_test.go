@@ -0,0 +1,168 @@
+package fulltext
+
+import (
+	"fmt"
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hammer writes to index from many goroutines at once and returns the
+// documents that must be left.
+func hammer(fulltext *Fulltext, index string) map[string]string {
+	words := []string{"okapi", "bm25", "ranking", "function", "tf", "idf"}
+	text := func(g, k int) string {
+		var b strings.Builder
+		for n := 0; n <= (g+k)%4; n++ {
+			b.WriteString(words[(g*k+n)%len(words)])
+			b.WriteString(" ")
+		}
+		return b.String()
+	}
+
+	var mutex sync.Mutex
+	want := make(map[string]string)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		g := g
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 30; k++ {
+				id := fmt.Sprintf("%d-%d", g, k)
+				if err := fulltext.AddDocs(index, map[string]string{id: text(g, k)}); err != nil {
+					log.Fatal(err)
+				}
+
+				// upsert every other document, remove every third
+				final := text(g, k)
+				if k%2 == 0 {
+					final = text(g+1, k)
+					if err := fulltext.AddDocs(index, map[string]string{id: final}); err != nil {
+						log.Fatal(err)
+					}
+				}
+				if k%3 == 0 {
+					if err := fulltext.DelDocs(index, id); err != nil {
+						log.Fatal(err)
+					}
+					continue
+				}
+
+				if _, err := fulltext.Search(new(Query).Index(index).Match("okapi bm25")); err != nil {
+					log.Fatal(err)
+				}
+
+				mutex.Lock()
+				want[id] = final
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return want
+}
+
+// checkStats compares the statistics of index with the ones of want.
+func checkStats(t *testing.T, fulltext *Fulltext, index string, want map[string]string) {
+	t.Helper()
+
+	var ts uint64
+	df := make(map[string]uint32)
+	for _, text := range want {
+		tf, _, l := termFreq(fulltext.defaultAnalyzer.Analyze(text))
+		ts += uint64(l)
+		for token := range tf {
+			df[token]++
+		}
+	}
+
+	r := reader{fulltext.db}
+	if ds, err := r.ds(index); err != nil || ds != uint32(len(want)) {
+		t.Fatalf("ds: %d want %d (%v)", ds, len(want), err)
+	}
+	if got, err := r.ts(index, ""); err != nil || got != ts {
+		t.Fatalf("ts: %d want %d (%v)", got, ts, err)
+	}
+	for token, n := range df {
+		idf, err := r.idf(index, "", token)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ps, err := r.postings(index, "", token, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if idf != n || len(ps) != int(n) {
+			t.Fatalf("%s: idf %d, %d postings, want %d", token, idf, len(ps), n)
+		}
+	}
+}
+
+func TestFulltextConcurrentWrites(t *testing.T) {
+	index := "concurrent"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	want := hammer(fulltext, index)
+	checkStats(t, fulltext, index, want)
+}
+
+func TestFulltextConcurrentLevelKV(t *testing.T) {
+	index := "concurrent"
+
+	db, err := NewLevelKV(t.TempDir(), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fulltext, err := NewWithKV(db, &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	want := hammer(fulltext, index)
+	checkStats(t, fulltext, index, want)
+}
+
+func TestBulkIndexerLock(t *testing.T) {
+	index := "locked"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	bulk, err := fulltext.NewBulkIndexer(index, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = bulk.Add(NewDocument("a").Add("", "okapi bm25")); err != nil {
+		log.Fatal(err)
+	}
+
+	// the write waits for the indexer, or it would be lost by its flush
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := fulltext.AddDocs(index, map[string]string{"b": "okapi"}); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	if err = bulk.Close(); err != nil {
+		log.Fatal(err)
+	}
+	<-done
+
+	checkStats(t, fulltext, index, map[string]string{"a": "okapi bm25", "b": "okapi"})
+}
@@ -1,10 +1,22 @@
 package fulltext
 
 const (
-	indexKey = "index"
-	tfKey    = "tf"
-	idfKey   = "idf"
-	tsKey    = "ts"
-	dsKey    = "ds"
-	docKey   = "id"
+	indexKey    = "index"
+	tfKey       = "tf"
+	idfKey      = "idf"
+	tsKey       = "ts"
+	dsKey       = "ds"
+	docKey      = "id"
+	normKey     = "norm"
+	oldNormKey  = "nm"
+	posKey      = "pos"
+	mappingKey  = "mapping"
+	srcKey      = "src"
+	pstKey      = "pst"
+	numKey      = "num"
+	ridKey      = "rid"
+	seqKey      = "seq"
+	verKey      = "ver"
+	freeKey     = "free"
+	settingsKey = "settings"
 )
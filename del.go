@@ -9,9 +9,9 @@ import (
 )
 
 type docT struct {
-	idK []byte
-	t   map[string]map[string]struct{}
-	len uint32
+	id     string
+	num    uint32
+	fields map[string]fieldTS
 }
 
 func (fulltext *Fulltext) DelDB() error {
@@ -19,6 +19,9 @@ func (fulltext *Fulltext) DelDB() error {
 }
 
 func (fulltext *Fulltext) DelIndex(index string) error {
+	unlock := fulltext.lock(index)
+	defer unlock()
+
 	return fulltext.removeIndex(index)
 }
 
@@ -30,10 +33,14 @@ func (fulltext *Fulltext) DelDocs(index string, docsID ...string) error {
 		return errors.New("fulltext/del: too much docs")
 	}
 
+	unlock := fulltext.lock(index)
+	defer unlock()
+
+	r := reader{fulltext.db}
 	docsT := make([]docT, 0, l)
 
 	if l == 1 {
-		ok, doc, err := fulltext.docT(index, docsID[0])
+		ok, doc, err := r.docT(index, docsID[0])
 		if err != nil {
 			return err
 		}
@@ -52,7 +59,7 @@ func (fulltext *Fulltext) DelDocs(index string, docsID ...string) error {
 		for _, id := range docsID {
 			id := id
 			wp.Go(func(ctx context.Context) error {
-				ok, doc, err := fulltext.docT(index, id)
+				ok, doc, err := r.docT(index, id)
 				if err != nil {
 					return err
 				}
@@ -76,53 +83,40 @@ func (fulltext *Fulltext) DelDocs(index string, docsID ...string) error {
 		return nil
 	}
 
-	tf := make(map[string]map[string]uint32)
-	idf := make(map[string]uint32)
-	idsK := make([][]byte, 0, len(docsT))
-
-	ts, err := fulltext.ts(index)
-	if err != nil {
-		return err
-	}
-
-	ds, err := fulltext.ds(index)
+	c, err := newChange(r, index)
 	if err != nil {
 		return err
 	}
+	seen := make(map[string]struct{}, len(docsT))
 
 	for _, doc := range docsT {
+		if _, exist := seen[doc.id]; exist {
+			continue
+		}
+		seen[doc.id] = struct{}{}
 
-		ts -= uint64(doc.len)
-		ds--
-
-		for token, idT := range doc.t {
-			if _, exist := tf[token]; !exist {
-				tfVal, err := fulltext.tf(index, token)
-				if err != nil {
-					return err
-				}
-				tf[token] = tfVal
-			}
-
-			for id := range idT {
-				delete(tf[token], id)
-				if _, exist := idf[token]; !exist {
-					idfVal, err := fulltext.idf(index, token)
-					if err != nil {
-						return err
-					}
-					idf[token] = idfVal - 1
-				} else {
-					idf[token]--
-				}
-			}
+		if err := c.remove(doc); err != nil {
+			return err
 		}
-		idsK = append(idsK, doc.idK)
 	}
 
-	if err = fulltext.removeMeta(index, tf, idf, idsK, ts, ds); err != nil {
+	if err = fulltext.putMeta(index, c); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// remove takes a document out of the index and frees its number.
+func (c *change) remove(doc docT) error {
+	num, _, err := c.r.docNum(c.i, doc.id)
+	if err != nil {
+		return err
+	}
+
+	if err := c.unindex(doc, num); err != nil {
+		return err
+	}
+	c.freed[doc.id] = num
+	return nil
+}
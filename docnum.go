@@ -0,0 +1,125 @@
+package fulltext
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrOldLayout is returned for indexes written in an older layout, such as
+// before postings were kept in blocks of doc numbers. Migrate converts them.
+var ErrOldLayout = errors.New("fulltext: index has an old layout, run Migrate")
+
+// layoutVersion is stored with every index written in the current layout.
+// Version 1 keyed the norms by id, version 2 by number.
+const layoutVersion = 2
+
+// Documents are numbered densely per index. Postings and norms refer to the
+// numbers, the num and rid entries map external ids to numbers and back. The
+// number of a removed document has no postings left and goes to the free
+// list, where the next added document takes it from.
+func numK(i, id string) []byte {
+	return []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, numKey, id))
+}
+
+func ridK(i string, num uint32) []byte {
+	key := []byte(fmt.Sprintf("%s:%s:%s:", indexKey, i, ridKey))
+	return binary.BigEndian.AppendUint32(key, num)
+}
+
+func (r reader) docNum(i, id string) (uint32, bool, error) {
+	val, err := r.Get(numK(i, id))
+	if err != nil || len(val) == 0 {
+		return 0, false, err
+	}
+
+	return byteToUint32(val), true, nil
+}
+
+func (r reader) docID(i string, num uint32) (string, error) {
+	val, err := r.Get(ridK(i, num))
+	if err != nil {
+		return "", err
+	}
+
+	return string(val), nil
+}
+
+func (r reader) docIDs(i string, nums map[uint32]struct{}) (map[uint32]string, error) {
+	ids := make(map[uint32]string, len(nums))
+	for num := range nums {
+		id, err := r.docID(i, num)
+		if err != nil {
+			return nil, err
+		}
+		ids[num] = id
+	}
+
+	return ids, nil
+}
+
+func freeK(i string, num uint32) []byte {
+	key := []byte(fmt.Sprintf("%s:%s:%s:", indexKey, i, freeKey))
+	return binary.BigEndian.AppendUint32(key, num)
+}
+
+// freeNums returns the n smallest free numbers at most.
+func (r reader) freeNums(i string, n int) ([]uint32, error) {
+	prefix := []byte(fmt.Sprintf("%s:%s:%s:", indexKey, i, freeKey))
+
+	var nums []uint32
+	iter := r.NewIterator(prefix)
+	for len(nums) < n && iter.Next() {
+		nums = append(nums, binary.BigEndian.Uint32(iter.Key()[len(prefix):]))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return nums, nil
+}
+
+// seq is the next doc number to hand out.
+func (r reader) seq(i string) (uint32, error) {
+	val, err := r.Get([]byte(fmt.Sprintf("%s:%s:%s", indexKey, i, seqKey)))
+	if err != nil || len(val) == 0 {
+		return 0, err
+	}
+
+	return byteToUint32(val), nil
+}
+
+func (r reader) version(i string) (uint32, error) {
+	val, err := r.Get([]byte(fmt.Sprintf("%s:%s:%s", indexKey, i, verKey)))
+	if err != nil || len(val) == 0 {
+		return 0, err
+	}
+
+	return byteToUint32(val), nil
+}
+
+// checkLayout fails for an index written in an older layout. An index
+// without a version is new unless it holds documents.
+func (r reader) checkLayout(i string) error {
+	ver, err := r.version(i)
+	if err != nil {
+		return err
+	}
+	if ver == layoutVersion {
+		return nil
+	}
+	if ver != 0 {
+		return ErrOldLayout
+	}
+
+	ds, err := r.ds(i)
+	if err != nil {
+		return err
+	}
+	if ds != 0 {
+		return ErrOldLayout
+	}
+
+	return nil
+}
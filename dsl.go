@@ -0,0 +1,521 @@
+package fulltext
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dslBody is a search request of the Elasticsearch query DSL.
+type dslBody struct {
+	Query   json.RawMessage `json:"query"`
+	From    int             `json:"from"`
+	Size    int             `json:"size"`
+	Sort    json.RawMessage `json:"sort"`
+	Source  json.RawMessage `json:"_source"`
+	Explain bool            `json:"explain"`
+}
+
+// dslLeaf holds the parameters of a leaf query on a field, given as an
+// object or, for the main one, as a value.
+type dslLeaf struct {
+	Query     json.RawMessage `json:"query"`
+	Value     json.RawMessage `json:"value"`
+	Operator  string          `json:"operator"`
+	Fuzziness json.RawMessage `json:"fuzziness"`
+	Slop      int             `json:"slop"`
+	Gt        json.RawMessage `json:"gt"`
+	Gte       json.RawMessage `json:"gte"`
+	Lt        json.RawMessage `json:"lt"`
+	Lte       json.RawMessage `json:"lte"`
+	Order     string          `json:"order"`
+	Boost     float32         `json:"boost"`
+}
+
+// UnmarshalJSON decodes a search request of the Elasticsearch query DSL into
+// the query, replacing everything but its index, which it keeps. The query is
+// left as is when the request is invalid. The request supports from, size,
+// sort, _source and the bool, match, match_phrase, term, terms, prefix and
+// range queries. Like Elasticsearch, the hits have their source unless
+// _source is false.
+func (query *Query) UnmarshalJSON(data []byte) error {
+	decoded := new(Query).Index(query.index)
+	if err := decoded.decode(data); err != nil {
+		return err
+	}
+
+	*query = *decoded
+	return nil
+}
+
+func (query *Query) decode(data []byte) error {
+	var body dslBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+
+	if dslPresent(body.Query) {
+		clause, err := dslClause(body.Query)
+		if err != nil {
+			return err
+		}
+		query.Clause(clause)
+	}
+
+	if body.From < 0 || body.Size < 0 {
+		return fmt.Errorf("fulltext/dsl: negative from %d or size %d", body.From, body.Size)
+	}
+	query.Limit(body.From, body.Size)
+	query.Explain(body.Explain)
+
+	if dslPresent(body.Sort) {
+		sorts, err := dslSorts(body.Sort)
+		if err != nil {
+			return err
+		}
+		query.sorts = sorts
+	}
+
+	switch source := bytes.TrimSpace(body.Source); {
+	case len(source) == 0 || string(source) == "true":
+		query.Source()
+	case string(source) == "false":
+	default:
+		var fields []string
+		if source[0] == '"' {
+			fields = make([]string, 1)
+			if err := json.Unmarshal(source, &fields[0]); err != nil {
+				return err
+			}
+		} else if err := json.Unmarshal(source, &fields); err != nil {
+			return err
+		}
+		query.Source(fields...)
+	}
+
+	return nil
+}
+
+// dslPresent tells whether a parameter is given, null standing for none.
+func dslPresent(data json.RawMessage) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) != 0 && string(data) != "null"
+}
+
+func dslClause(data json.RawMessage) (Clause, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return nil, err
+	}
+	if len(typed) != 1 {
+		return nil, fmt.Errorf("fulltext/dsl: a query has one type, not %d", len(typed))
+	}
+
+	for kind, params := range typed {
+		if kind == "bool" {
+			return dslBool(params)
+		}
+
+		if kind == "terms" {
+			return dslTerms(params)
+		}
+
+		field, leaf, err := dslField(params)
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case "match":
+			text, err := dslString(leaf.Query)
+			if err != nil {
+				return nil, err
+			}
+			m := &MatchClause{Text: text, Fields: []string{field}, Boost: leaf.Boost}
+			switch strings.ToLower(leaf.Operator) {
+			case "", "or":
+			case "and":
+				m.RequireAll = true
+			default:
+				return nil, fmt.Errorf("fulltext/dsl: unknown operator %q", leaf.Operator)
+			}
+			if m.Fuzziness, err = dslFuzziness(leaf.Fuzziness); err != nil {
+				return nil, err
+			}
+			return m, nil
+
+		case "match_phrase":
+			text, err := dslString(leaf.Query)
+			if err != nil {
+				return nil, err
+			}
+			return &PhraseClause{Text: text, Slop: leaf.Slop, Fields: []string{field}, Boost: leaf.Boost}, nil
+
+		case "term":
+			value, err := dslString(leaf.Value)
+			if err != nil {
+				return nil, err
+			}
+			return &TermClause{Field: field, Value: value, Boost: leaf.Boost}, nil
+
+		case "prefix":
+			value, err := dslString(leaf.Value)
+			if err != nil {
+				return nil, err
+			}
+			return &PrefixClause{Prefix: value, Fields: []string{field}, Boost: leaf.Boost}, nil
+
+		case "range":
+			r := &RangeClause{Field: field, Boost: leaf.Boost}
+			for _, bound := range []struct {
+				raw json.RawMessage
+				to  *string
+			}{{leaf.Gt, &r.Gt}, {leaf.Gte, &r.Gte}, {leaf.Lt, &r.Lt}, {leaf.Lte, &r.Lte}} {
+				if len(bound.raw) == 0 {
+					continue
+				}
+				if *bound.to, err = dslString(bound.raw); err != nil {
+					return nil, err
+				}
+			}
+			return r, nil
+		}
+
+		return nil, fmt.Errorf("fulltext/dsl: unsupported query %q", kind)
+	}
+	return nil, nil
+}
+
+func dslBool(data json.RawMessage) (Clause, error) {
+	var params struct {
+		Must               json.RawMessage `json:"must"`
+		Filter             json.RawMessage `json:"filter"`
+		Should             json.RawMessage `json:"should"`
+		MustNot            json.RawMessage `json:"must_not"`
+		MinimumShouldMatch json.RawMessage `json:"minimum_should_match"`
+		Boost              float32         `json:"boost"`
+	}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	b := &BoolClause{Boost: params.Boost}
+	for _, occur := range []struct {
+		raw     json.RawMessage
+		clauses *[]Clause
+	}{{params.Must, &b.Must}, {params.Filter, &b.Filter}, {params.Should, &b.Should}, {params.MustNot, &b.MustNot}} {
+		clauses, err := dslClauses(occur.raw)
+		if err != nil {
+			return nil, err
+		}
+		*occur.clauses = clauses
+	}
+
+	min, err := dslMinimumShouldMatch(params.MinimumShouldMatch, len(b.Should))
+	if err != nil {
+		return nil, err
+	}
+	b.MinimumShouldMatch = min
+
+	return b, nil
+}
+
+// dslClauses decodes a query or an array of them.
+func dslClauses(data json.RawMessage) ([]Clause, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if data[0] != '[' {
+		clause, err := dslClause(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Clause{clause}, nil
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	clauses := make([]Clause, 0, len(list))
+	for _, raw := range list {
+		clause, err := dslClause(raw)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// dslTerms decodes a terms query, which matches any of the values of its
+// field.
+func dslTerms(data json.RawMessage) (Clause, error) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	b := &BoolClause{}
+	if raw, exist := params["boost"]; exist {
+		if err := json.Unmarshal(raw, &b.Boost); err != nil {
+			return nil, err
+		}
+		delete(params, "boost")
+	}
+	if len(params) != 1 {
+		return nil, errors.New("fulltext/dsl: a terms query has one field")
+	}
+
+	for field, raw := range params {
+		var values []json.RawMessage
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("fulltext/dsl: no terms for %q", field)
+		}
+		for _, v := range values {
+			value, err := dslString(v)
+			if err != nil {
+				return nil, err
+			}
+			b.Should = append(b.Should, &TermClause{Field: field, Value: value})
+		}
+	}
+	return b, nil
+}
+
+// dslField decodes the field of a leaf query and its parameters.
+func dslField(data json.RawMessage) (string, *dslLeaf, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", nil, err
+	}
+	if len(fields) != 1 {
+		return "", nil, fmt.Errorf("fulltext/dsl: a query has one field, not %d", len(fields))
+	}
+
+	for field, raw := range fields {
+		leaf := new(dslLeaf)
+		raw = bytes.TrimSpace(raw)
+		if len(raw) != 0 && raw[0] == '{' {
+			if err := json.Unmarshal(raw, leaf); err != nil {
+				return "", nil, err
+			}
+		} else {
+			leaf.Query, leaf.Value = raw, raw
+		}
+		if len(leaf.Query) == 0 {
+			leaf.Query = leaf.Value
+		}
+		if len(leaf.Value) == 0 {
+			leaf.Value = leaf.Query
+		}
+		return field, leaf, nil
+	}
+	return "", nil, nil
+}
+
+// dslString returns a string, number or boolean as text, the way it is
+// indexed.
+func dslString(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", errors.New("fulltext/dsl: missing value")
+	}
+	if raw[0] != '"' {
+		if raw[0] == '{' || raw[0] == '[' || string(raw) == "null" {
+			return "", fmt.Errorf("fulltext/dsl: %s is not a value", raw)
+		}
+		return string(raw), nil
+	}
+	var str string
+	err := json.Unmarshal(raw, &str)
+	return str, err
+}
+
+func dslFuzziness(raw json.RawMessage) (int, error) {
+	if len(raw) == 0 {
+		return 0, nil
+	}
+	str, err := dslString(raw)
+	if err != nil {
+		return 0, err
+	}
+	if strings.EqualFold(str, "auto") {
+		return AutoFuzziness, nil
+	}
+	edits, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("fulltext/dsl: bad fuzziness %q", str)
+	}
+	return edits, nil
+}
+
+// dslMinimumShouldMatch decodes a number of should clauses, or a percentage
+// of them rounded down, negative for the ones that may be missed.
+func dslMinimumShouldMatch(raw json.RawMessage, should int) (int, error) {
+	if len(raw) == 0 {
+		return 0, nil
+	}
+	str, err := dslString(raw)
+	if err != nil {
+		return 0, err
+	}
+	if percent := strings.TrimSuffix(str, "%"); percent != str {
+		p, err := strconv.Atoi(percent)
+		if err != nil {
+			return 0, fmt.Errorf("fulltext/dsl: bad minimum_should_match %q", str)
+		}
+		if p < 0 {
+			return -(should * -p / 100), nil
+		}
+		return should * p / 100, nil
+	}
+	min, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("fulltext/dsl: bad minimum_should_match %q", str)
+	}
+	return min, nil
+}
+
+// dslSorts decodes a sort, a field or an array of fields, each a name or an
+// object giving its order.
+func dslSorts(data json.RawMessage) ([]sortField, error) {
+	data = bytes.TrimSpace(data)
+	list := []json.RawMessage{data}
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+	}
+
+	sorts := make([]sortField, 0, len(list))
+	for _, raw := range list {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) != 0 && raw[0] == '"' {
+			var field string
+			if err := json.Unmarshal(raw, &field); err != nil {
+				return nil, err
+			}
+			sorts = append(sorts, sortField{field, field == ScoreField})
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("fulltext/dsl: a sort has one field, not %d", len(fields))
+		}
+		for field, params := range fields {
+			order := ""
+			params = bytes.TrimSpace(params)
+			if len(params) != 0 && params[0] == '{' {
+				var leaf dslLeaf
+				if err := json.Unmarshal(params, &leaf); err != nil {
+					return nil, err
+				}
+				order = leaf.Order
+			} else if err := json.Unmarshal(params, &order); err != nil {
+				return nil, err
+			}
+
+			desc := field == ScoreField
+			switch strings.ToLower(order) {
+			case "":
+			case "asc":
+				desc = false
+			case "desc":
+				desc = true
+			default:
+				return nil, fmt.Errorf("fulltext/dsl: unknown order %q", order)
+			}
+			sorts = append(sorts, sortField{field, desc})
+		}
+	}
+	return sorts, nil
+}
+
+// ESResponse is hits encoded by encoding/json like the response of an
+// Elasticsearch search.
+type ESResponse Hits
+
+// ESResponse returns the hits to encode like the response of an
+// Elasticsearch search.
+func (hits Hits) ESResponse() ESResponse {
+	return ESResponse(hits)
+}
+
+// MarshalJSON encodes the response with the total, the documents with their
+// score, source, highlights and explanation, and the suggestions as a
+// did_you_mean phrase suggestion.
+func (hits ESResponse) MarshalJSON() ([]byte, error) {
+	type dslHit struct {
+		Index       string                 `json:"_index"`
+		ID          string                 `json:"_id"`
+		Score       float32                `json:"_score"`
+		Source      map[string]interface{} `json:"_source,omitempty"`
+		Highlight   map[string][]string    `json:"highlight,omitempty"`
+		Explanation *Explanation           `json:"_explanation,omitempty"`
+	}
+	type dslOption struct {
+		Text string `json:"text"`
+	}
+	type dslSuggestion struct {
+		Options []dslOption `json:"options"`
+	}
+	var response struct {
+		Took     int  `json:"took"`
+		TimedOut bool `json:"timed_out"`
+		Hits     struct {
+			Total struct {
+				Value    int    `json:"value"`
+				Relation string `json:"relation"`
+			} `json:"total"`
+			MaxScore *float32 `json:"max_score"`
+			Hits     []dslHit `json:"hits"`
+		} `json:"hits"`
+		Suggest map[string][]dslSuggestion `json:"suggest,omitempty"`
+	}
+
+	response.Took = hits.Took
+	response.Hits.Total.Value = hits.Total
+	response.Hits.Total.Relation = "eq"
+	response.Hits.Hits = make([]dslHit, 0, len(hits.Docs))
+	for k, doc := range hits.Docs {
+		if k == 0 || doc.Score > *response.Hits.MaxScore {
+			score := doc.Score
+			response.Hits.MaxScore = &score
+		}
+
+		hit := dslHit{Index: hits.index, ID: doc.ID, Score: doc.Score, Highlight: doc.Highlights, Explanation: doc.Explanation}
+		if doc.Fields != nil {
+			hit.Source = make(map[string]interface{}, len(doc.Fields))
+			for name, values := range doc.Fields {
+				if len(values) == 1 {
+					hit.Source[name] = values[0]
+				} else {
+					hit.Source[name] = values
+				}
+			}
+		}
+		response.Hits.Hits = append(response.Hits.Hits, hit)
+	}
+
+	if len(hits.Suggestions) != 0 {
+		suggestion := dslSuggestion{Options: make([]dslOption, 0, len(hits.Suggestions))}
+		for _, text := range hits.Suggestions {
+			suggestion.Options = append(suggestion.Options, dslOption{text})
+		}
+		response.Suggest = map[string][]dslSuggestion{"did_you_mean": {suggestion}}
+	}
+
+	return json.Marshal(response)
+}
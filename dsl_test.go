@@ -0,0 +1,176 @@
+package fulltext
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestFulltextDSL(t *testing.T) {
+	index := "dsl"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.PutMapping(index, Mapping{Source: true, Fields: map[string]FieldMapping{
+		"title": {Type: FieldText},
+		"tag":   {Type: FieldKeyword},
+		"year":  {Type: FieldKeyword},
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = fulltext.AddDocuments(index,
+		NewDocument("document_0").Add("title", "okapi bm25 ranking").Add("tag", "ir", "ranking").Add("year", "1994"),
+		NewDocument("document_1").Add("title", "bm25 for the web").Add("tag", "ir").Add("year", "2004"),
+		NewDocument("document_2").Add("title", "lucene scoring").Add("tag", "search").Add("year", "2010"),
+		NewDocument("document_3").Add("title", "draft on bm25").Add("tag", "draft").Add("year", "2012"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	search := func(body string) []Doc {
+		query := new(Query).Index(index)
+		if err := json.Unmarshal([]byte(body), query); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		hits, err := fulltext.Search(query)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return hits.Docs
+	}
+	ids := func(docs []Doc) []string {
+		var ids []string
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+		return ids
+	}
+
+	for body, want := range map[string][]string{
+		`{"query": {"bool": {"must": {"match": {"title": "bm25"}}, "must_not": [{"term": {"tag": "draft"}}]}}, "sort": [{"year": "desc"}]}`:                     {"document_1", "document_0"},
+		`{"query": {"terms": {"tag": ["search", "draft"]}}, "sort": ["year"]}`:                                                                                  {"document_2", "document_3"},
+		`{"query": {"range": {"year": {"gte": 2000, "lt": "2012"}}}, "sort": {"year": {"order": "asc"}}}`:                                                       {"document_1", "document_2"},
+		`{"query": {"match_phrase": {"title": {"query": "okapi ranking", "slop": 1}}}}`:                                                                         {"document_0"},
+		`{"query": {"prefix": {"title": "luc"}}}`:                                                                                                               {"document_2"},
+		`{"query": {"match": {"title": {"query": "bm25 draft", "operator": "and"}}}}`:                                                                           {"document_3"},
+		`{"query": {"bool": {"should": [{"term": {"tag": "ir"}}, {"match": {"title": "bm25"}}, {"match": {"title": "web"}}], "minimum_should_match": "100%"}}}`: {"document_1"},
+		`{"query": {"bool": {"filter": {"term": {"tag": "ir"}}, "should": {"match": {"title": "web"}}}}, "sort": ["_score", "year"]}`:                           {"document_1", "document_0"},
+		`{"query": {"match": {"title": "bm25"}}, "sort": [{"year": "asc"}], "from": 1, "size": 1}`:                                                              {"document_1"},
+	} {
+		if got := ids(search(body)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: %v, want %v", body, got, want)
+		}
+	}
+
+	var query Query
+	for _, body := range []string{
+		`{"query": {"regexp": {"title": "b.*"}}}`,
+		`{"query": {"terms": {"tag": []}}}`,
+	} {
+		if err := json.Unmarshal([]byte(body), &query); err == nil {
+			t.Fatalf("%s: decoded", body)
+		}
+	}
+
+	// a decoded query replaces the previous one, and a failed one keeps it
+	reused := new(Query).Index(index)
+	for _, step := range []struct {
+		body  string
+		valid bool
+		want  []string
+	}{
+		{`{"query": {"terms": {"tag": ["search", "draft"]}}, "sort": [{"year": "desc"}]}`, true, []string{"document_3", "document_2"}},
+		{`{"query": {"match": {"title": "okapi"}}, "sort": [{"year": "sideways"}]}`, false, []string{"document_3", "document_2"}},
+		{`{"query": {"term": {"tag": "ir"}}, "sort": {"year": "asc", "tag": "asc"}}`, false, []string{"document_3", "document_2"}},
+		{`{"query": {"term": {"tag": "ir"}}, "from": -1}`, false, []string{"document_3", "document_2"}},
+		{`{"query": {"term": {"tag": "ir"}}, "size": -5}`, false, []string{"document_3", "document_2"}},
+		{`{"query": {"match": {"title": "bm25"}}, "sort": ["year"]}`, true, []string{"document_0", "document_1", "document_3"}},
+	} {
+		if err := json.Unmarshal([]byte(step.body), reused); (err == nil) != step.valid {
+			t.Fatalf("%s: %v", step.body, err)
+		}
+		hits, err := fulltext.Search(reused)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if got := ids(hits.Docs); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("after %s: %v, want %v", step.body, got, step.want)
+		}
+	}
+	hits, err := fulltext.Search(new(Query).Index(index).Term("tag", "ir").Limit(-1, 1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(hits.Docs) != 1 || hits.Total != 2 {
+		t.Fatalf("negative from: %+v", hits)
+	}
+	if got := ids(search(`{"query": {"term": {"tag": "ir"}}, "sort": null}`)); len(got) != 2 {
+		t.Fatalf("null sort: %v", got)
+	}
+
+	hits, err = fulltext.Search(new(Query).Index(index).Term("tag", "ir").Source("tag", "year"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := json.Marshal(hits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(`{"Total":2,`)) {
+		t.Fatalf("hits: %s", data)
+	}
+	if data, err = json.Marshal(hits.ESResponse()); err != nil {
+		log.Fatal(err)
+	}
+	var response struct {
+		TimedOut bool `json:"timed_out"`
+		Hits     struct {
+			Total struct {
+				Value    int    `json:"value"`
+				Relation string `json:"relation"`
+			} `json:"total"`
+			MaxScore float32 `json:"max_score"`
+			Hits     []struct {
+				Index  string                 `json:"_index"`
+				ID     string                 `json:"_id"`
+				Score  float32                `json:"_score"`
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err = json.Unmarshal(data, &response); err != nil {
+		log.Fatal(err)
+	}
+	if response.Hits.Total.Value != 2 || response.Hits.Total.Relation != "eq" || len(response.Hits.Hits) != 2 {
+		t.Fatalf("response: %s", data)
+	}
+	hit := response.Hits.Hits[0]
+	if hit.Index != index || hit.Score != response.Hits.MaxScore || hit.Source["year"] == nil {
+		t.Fatalf("hit: %s", data)
+	}
+	if tags, ok := response.Hits.Hits[0].Source["tag"].([]interface{}); hit.ID == "document_0" && (!ok || len(tags) != 2) {
+		t.Fatalf("multi-valued source: %s", data)
+	}
+
+	query = Query{index: index}
+	if err = json.Unmarshal([]byte(`{"query": {"match": {"title": "bm25"}}, "explain": true}`), &query); err != nil {
+		log.Fatal(err)
+	}
+	if hits, err = fulltext.Search(&query); err != nil {
+		log.Fatal(err)
+	}
+	if data, err = json.Marshal(hits.ESResponse()); err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"_explanation":{"value":`)) {
+		t.Fatalf("explain: %s", data)
+	}
+}
@@ -0,0 +1,272 @@
+package fulltext
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Explanation tells how a score was computed: Description computes Value
+// from the values of Details. It is encoded like the explanations of
+// Elasticsearch.
+type Explanation struct {
+	Value       float32       `json:"value"`
+	Description string        `json:"description"`
+	Details     []Explanation `json:"details,omitempty"`
+}
+
+func (e Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return b.String()
+}
+
+func (e Explanation) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%g = %s\n", strings.Repeat("  ", depth), e.Value, e.Description)
+	for _, detail := range e.Details {
+		detail.write(b, depth+1)
+	}
+}
+
+// explaining collects the explanations of the scores of some documents while
+// a query tree is evaluated.
+type explaining struct {
+	nums map[uint32]struct{}
+	// last holds the explanations of the clause evaluated last
+	last map[uint32]*Explanation
+}
+
+// Explain makes every hit carry the explanation of its score in
+// Doc.Explanation.
+func (query *Query) Explain(explain bool) *Query {
+	query.explain = explain
+	return query
+}
+
+// Explain explains the score of the document id for query, as a tree of the
+// clauses of the query down to the statistics each term is scored with. It
+// returns nil when the document does not match the query.
+func (fulltext *Fulltext) Explain(query *Query, id string) (*Explanation, error) {
+	if query == nil || query.index == "" {
+		return nil, errors.New("fulltext/explain: no index")
+	}
+	clause := query.clause()
+	if clause == nil {
+		return nil, nil
+	}
+
+	snap, err := fulltext.db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	r := reader{snap}
+
+	e, err := fulltext.executor(r, query)
+	if err != nil {
+		return nil, err
+	}
+	num, exist, err := r.docNum(query.index, id)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, fmt.Errorf("fulltext/explain: no document %q", id)
+	}
+
+	explanations, err := e.explain(clause, map[uint32]struct{}{num: {}})
+	if err != nil {
+		return nil, err
+	}
+	return explanations[num], nil
+}
+
+// fillExplanations explains the scores of the hits.
+func (e *executor) fillExplanations(clause Clause, ids map[uint32]string, docs []Doc) error {
+	nums := make(map[string]uint32, len(docs))
+	for num, id := range ids {
+		nums[id] = num
+	}
+	explained := make(map[uint32]struct{}, len(docs))
+	for _, doc := range docs {
+		explained[nums[doc.ID]] = struct{}{}
+	}
+
+	explanations, err := e.explain(clause, explained)
+	if err != nil {
+		return err
+	}
+	for k := range docs {
+		docs[k].Explanation = explanations[nums[docs[k].ID]]
+	}
+	return nil
+}
+
+// explain evaluates clause again to explain the scores of the documents nums.
+func (e *executor) explain(clause Clause, nums map[uint32]struct{}) (map[uint32]*Explanation, error) {
+	explainer := *e
+	explainer.explaining = &explaining{nums: nums}
+	_, explanations, err := explainer.eval(clause)
+	return explanations, err
+}
+
+// eval evaluates a clause, with the explanations of the matching documents
+// when the executor explains.
+func (e *executor) eval(clause Clause) (map[uint32]float32, map[uint32]*Explanation, error) {
+	if e.explaining == nil {
+		scores, err := clause.eval(e)
+		return scores, nil, err
+	}
+
+	e.explaining.last = nil
+	scores, err := clause.eval(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	last := e.explaining.last
+	e.explaining.last = nil
+
+	explanations := make(map[uint32]*Explanation)
+	for num := range e.explaining.nums {
+		score, exist := scores[num]
+		if !exist {
+			continue
+		}
+		explanation := last[num]
+		if explanation == nil {
+			explanation = &Explanation{}
+		}
+		explanation.Value = score
+		if explanation.Description == "" {
+			explanation.Description = describe(clause)
+		}
+		explanations[num] = explanation
+	}
+	return scores, explanations, nil
+}
+
+// explainScores explains the scores of the postings, times boost, like
+// score computes them.
+func (e *executor) explainScores(tfidfs []tokenTFIDF, boost float32, scores map[uint32]float32) error {
+	last := make(map[uint32]*Explanation)
+	e.explaining.last = last
+
+	var s *scorer
+	for num := range e.explaining.nums {
+		if _, exist := scores[num]; !exist {
+			continue
+		}
+		if e.filter {
+			last[num] = &Explanation{Details: []Explanation{{Description: "filter, not scored"}}}
+			continue
+		}
+
+		if s == nil {
+			var err error
+			if s, err = newScorer(e.r, e.i, e.mapping, e.similarity, tfidfs); err != nil {
+				return err
+			}
+		}
+		explanation := &Explanation{Details: s.explain(tfidfs, num)}
+		if boost != 0 && boost != 1 {
+			explanation.Details = append(explanation.Details, Explanation{Value: boost, Description: "boost of the clause"})
+		}
+		last[num] = explanation
+	}
+	return nil
+}
+
+// explain explains the score of document num for every token holding it.
+func (s *scorer) explain(tokensTFIDF []tokenTFIDF, num uint32) []Explanation {
+	var explanations []Explanation
+	for _, tfidf := range tokensTFIDF {
+		if _, exist := tfidf.tokenTF[num]; !exist {
+			continue
+		}
+		if tfidf.constant {
+			explanations = append(explanations, Explanation{Value: tfidf.boost, Description: fmt.Sprintf("constant score of %q", tfidf.term)})
+			continue
+		}
+
+		term, fields := s.stats(tfidf)
+		docFields := s.docFields(tfidf, fields, num, nil)
+		if len(docFields) == 0 {
+			continue
+		}
+
+		explanation := Explanation{
+			Value:       s.similarity.Score(term, docFields) * tfidf.boost,
+			Description: fmt.Sprintf("weight of %q", tfidf.term),
+			Details:     []Explanation{explainSimilarity(s.similarity, term, docFields)},
+		}
+		if tfidf.boost != 1 {
+			explanation.Details = append(explanation.Details, Explanation{Value: tfidf.boost, Description: "boost of the term"})
+		}
+		explanations = append(explanations, explanation)
+	}
+	return explanations
+}
+
+func explainSimilarity(similarity Similarity, term TermStats, fields []FieldStats) Explanation {
+	if explainer, ok := similarity.(Explainer); ok {
+		return explainer.Explain(term, fields)
+	}
+
+	explanation := Explanation{
+		Value:       similarity.Score(term, fields),
+		Description: fmt.Sprintf("%T", similarity),
+		Details:     explainTermStats(term),
+	}
+	for _, f := range fields {
+		explanation.Details = append(explanation.Details, Explanation{
+			Description: fmt.Sprintf("field %q", f.Field),
+			Details:     explainFieldStats(f),
+		})
+	}
+	return explanation
+}
+
+// describe names a clause in its explanation.
+func describe(clause Clause) string {
+	in := func(fields []string) string {
+		if len(fields) == 0 {
+			return ""
+		}
+		return " in " + strings.Join(fields, ", ")
+	}
+
+	switch c := clause.(type) {
+	case *MatchClause:
+		if c.RequireAll {
+			return fmt.Sprintf("match all of %q%s", c.Text, in(c.Fields))
+		}
+		return fmt.Sprintf("match %q%s", c.Text, in(c.Fields))
+	case *tokenClause:
+		return fmt.Sprintf("token %q%s", c.token, in(c.fields))
+	case *TermClause:
+		return fmt.Sprintf("term %q in %s", c.Value, c.Field)
+	case *PhraseClause:
+		text := c.Text
+		if text == "" {
+			text = strings.Join(c.Terms, " ")
+		}
+		return fmt.Sprintf("phrase %q~%d%s", text, c.Slop, in(c.Fields))
+	case *PrefixClause:
+		return fmt.Sprintf("prefix %q%s", c.Prefix, in(c.Fields))
+	case *WildcardClause:
+		return fmt.Sprintf("wildcard %q%s", c.Pattern, in(c.Fields))
+	case *RegexpClause:
+		return fmt.Sprintf("regexp %q%s", c.Expr, in(c.Fields))
+	case *FuzzyClause:
+		return fmt.Sprintf("fuzzy %q~%d%s", c.Term, c.Edits, in(c.Fields))
+	case *RangeClause:
+		var bounds []string
+		for _, bound := range []struct{ op, value string }{{">", c.Gt}, {">=", c.Gte}, {"<", c.Lt}, {"<=", c.Lte}} {
+			if bound.value != "" {
+				bounds = append(bounds, bound.op+" "+bound.value)
+			}
+		}
+		return fmt.Sprintf("range %s %s", c.Field, strings.Join(bounds, ", "))
+	}
+	return fmt.Sprintf("%T", clause)
+}
@@ -0,0 +1,113 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFulltextExplain(t *testing.T) {
+	index := "explain"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.AddDocs(index, map[string]string{
+		"document_0": "okapi bm25 ranking function",
+		"document_1": "okapi okapi bm25 ranking in the okapi system",
+		"document_2": "lucene scoring",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// leaves sums the term weights and constant scores times the clause boosts
+	var leaves func(e Explanation) float64
+	leaves = func(e Explanation) float64 {
+		if strings.HasPrefix(e.Description, "weight of") || strings.HasPrefix(e.Description, "constant score") {
+			return float64(e.Value)
+		}
+		sum, boost := 0.0, 1.0
+		for _, detail := range e.Details {
+			if detail.Description == "boost of the clause" {
+				boost *= float64(detail.Value)
+				continue
+			}
+			sum += leaves(detail)
+		}
+		return sum * boost
+	}
+
+	for name, similarity := range map[string]Similarity{
+		"bm25":  NewBM25(),
+		"bm25+": NewBM25Plus(),
+		"tfidf": TFIDF{},
+		"lmd":   LMDirichlet{Mu: 100},
+		"lmjm":  NewLMJelinekMercer(),
+	} {
+		fulltext.SetSimilarity(index, similarity)
+
+		query := new(Query).Index(index).Match("okapi ranking").Must("bm25^2").Explain(true)
+		hits, err := fulltext.Search(query)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if hits.Total != 2 {
+			t.Fatalf("%s: %+v", name, hits.Docs)
+		}
+
+		for _, doc := range hits.Docs {
+			e := doc.Explanation
+			if e == nil || e.Value != doc.Score {
+				t.Fatalf("%s: %s scored %v, explained %+v", name, doc.ID, doc.Score, e)
+			}
+			if sum := leaves(*e); math.Abs(sum-float64(doc.Score)) > 1e-4 {
+				t.Fatalf("%s: %s scored %v, weights sum to %v\n%s", name, doc.ID, doc.Score, sum, e)
+			}
+			for _, want := range []string{`weight of "okapi"`, `weight of "bm25"`, "boost of the clause", "freq, occurrences", "len, tokens"} {
+				if !strings.Contains(e.String(), want) {
+					t.Fatalf("%s: no %q in\n%s", name, want, e)
+				}
+			}
+
+			explained, err := fulltext.Explain(query, doc.ID)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if explained.String() != e.String() {
+				t.Fatalf("%s: explained\n%s, hit\n%s", name, explained, e)
+			}
+		}
+	}
+	fulltext.SetSimilarity(index, nil)
+
+	query := new(Query).Index(index).Match("okapi")
+	e, err := fulltext.Explain(query, "document_0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, want := range []string{"idf, log(1 + (N - df + 0.5) / (df + 0.5))", "N, documents in the index", "df, documents holding the term", "tf, sum of the fields", "avgLen", "k1"} {
+		if !strings.Contains(e.String(), want) {
+			t.Fatalf("no %q in\n%s", want, e)
+		}
+	}
+
+	if e, err = fulltext.Explain(query, "document_2"); err != nil || e != nil {
+		t.Fatalf("no match explained %v, %v", e, err)
+	}
+	if _, err = fulltext.Explain(query, "document_3"); err == nil {
+		t.Fatalf("unknown document explained")
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("okapi"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Docs[0].Explanation != nil {
+		t.Fatalf("explained without Explain: %+v", hits.Docs[0])
+	}
+}
@@ -2,59 +2,109 @@ package fulltext
 
 import (
 	"errors"
-	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/filter"
-	"github.com/syndtr/goleveldb/leveldb/opt"
 	"path"
+	"sync"
 )
 
 type Fulltext struct {
 	dbPath    string
-	db        *leveldb.DB
+	db        KV
 	tokenizer Tokenizer
-	stopWords map[string]struct{}
-	k1        float32
-	b         float32
 	retSize   int
+	// analyzers holds the analyzers registered by name, defaultAnalyzer
+	// analyses the fields whose mapping names none.
+	defaultAnalyzer *Analyzer
+	analyzers       sync.Map
+	// similarities holds the Similarity of the indexes not scored with
+	// defaultSimilarity.
+	defaultSimilarity Similarity
+	similarities      sync.Map
+	// locks holds a *sync.Mutex per index. Writes read the statistics of an
+	// index and write them back, so they are serialized per index.
+	locks sync.Map
 }
 
-func New(filePath string, tokenizer Tokenizer) (*Fulltext, error) {
+// New opens the indexes stored under filePath, in a goleveldb store in its db
+// directory. Stop words are read from its stop_word.txt unless an option
+// gives them or the default analyzer.
+func New(filePath string, tokenizer Tokenizer, opts ...Option) (*Fulltext, error) {
 	if tokenizer == nil {
 		return nil, errors.New("fulltext/new: tokenizer is nil")
 	}
-	stopWords := make(map[string]struct{})
-	dbPath := path.Join(filePath, "db")
-	o := &opt.Options{
-		Filter: filter.NewBloomFilter(10),
+
+	o := newOptions(opts)
+	if !o.stopWordSource && o.analyzer == nil {
+		o.stopWordFile = path.Join(filePath, "stop_word.txt")
 	}
-	db, err := leveldb.OpenFile(dbPath, o)
+
+	dbPath := path.Join(filePath, "db")
+	db, err := NewLevelKV(dbPath, &o.leveldb)
 	if err != nil {
 		return nil, err
 	}
 
-	lines, err := readLines(path.Join(filePath, "stop_word.txt"))
+	fulltext, err := newFulltext(db, tokenizer, o)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
+	fulltext.dbPath = dbPath
 
-	for _, w := range lines {
-		stopWords[w] = struct{}{}
+	return fulltext, nil
+}
+
+// NewWithKV builds a Fulltext on top of an already opened store, e.g. NewMemKV
+// for ephemeral indexes. The options tuning goleveldb do not apply.
+func NewWithKV(db KV, tokenizer Tokenizer, opts ...Option) (*Fulltext, error) {
+	if db == nil {
+		return nil, errors.New("fulltext/new: kv is nil")
+	}
+	if tokenizer == nil {
+		return nil, errors.New("fulltext/new: tokenizer is nil")
 	}
-	stopWords[" "] = struct{}{}
-	stopWords["\n"] = struct{}{}
 
+	return newFulltext(db, tokenizer, newOptions(opts))
+}
+
+func newFulltext(db KV, tokenizer Tokenizer, o *options) (*Fulltext, error) {
 	fulltext := &Fulltext{
-		dbPath:    dbPath,
 		db:        db,
 		tokenizer: tokenizer,
-		stopWords: stopWords,
-		k1:        1.4,
-		b:         0.75,
-		retSize:   10,
+		retSize:   o.pageSize,
+
+		defaultSimilarity: o.similarity,
+	}
+
+	if o.analyzer != nil {
+		fulltext.defaultAnalyzer = fulltext.withTokenizer(o.analyzer)
+		return fulltext, nil
+	}
+
+	stopWords := o.stopWords
+	if o.stopWordFile != "" {
+		lines, err := readLines(o.stopWordFile)
+		if err != nil {
+			return nil, err
+		}
+		stopWords = lines
 	}
+
+	// the default analyzer is the tokenizer with the stop words removed
+	stop := NewStopFilter(stopWords...)
+	stop.Words[" "] = struct{}{}
+	stop.Words["\n"] = struct{}{}
+	fulltext.defaultAnalyzer = &Analyzer{Tokenizer: tokenizer, TokenFilters: []TokenFilter{stop}}
+
 	return fulltext, nil
 }
 
+// lock takes the write lock of index and returns the function releasing it.
+func (fulltext *Fulltext) lock(index string) func() {
+	mutex, _ := fulltext.locks.LoadOrStore(index, new(sync.Mutex))
+	mutex.(*sync.Mutex).Lock()
+	return mutex.(*sync.Mutex).Unlock
+}
+
 func (fulltext *Fulltext) Free() error {
 	return fulltext.db.Close()
 }
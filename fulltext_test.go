@@ -68,6 +68,153 @@ func TestFulltextEn(t *testing.T) {
 	}
 }
 
+func TestFulltextDocLen(t *testing.T) {
+	index := "len"
+
+	docs := make(map[string]string)
+
+	docs["short"] = "bm25 ranking"
+	docs["long"] = "bm25 ranking function used by search engines to estimate the relevance of documents"
+
+	fulltext, err := New("./len", &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.DelDB()
+	defer fulltext.Free()
+
+	err = fulltext.AddDocs(index, docs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if hits.Total != 2 || hits.Docs[0].ID != "short" || hits.Docs[0].Score <= hits.Docs[1].Score {
+		t.Fatalf("short document should rank first: %+v", hits.Docs)
+	}
+}
+
+func TestFulltextUpsert(t *testing.T) {
+	index := "upsert"
+
+	fulltext, err := New("./upsert", &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.DelDB()
+	defer fulltext.Free()
+
+	err = fulltext.AddDocs(index, map[string]string{"document_0": "a b c", "document_1": "a d"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = fulltext.AddDocs(index, map[string]string{"document_0": "a e"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := reader{fulltext.db}
+	ts, err := r.ts(index, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	ds, err := r.ds(index)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ts != 4 || ds != 2 {
+		t.Fatalf("ts: %d ds: %d", ts, ds)
+	}
+
+	for token, want := range map[string]uint32{"a": 2, "b": 0, "c": 0, "e": 1} {
+		idf, err := r.idf(index, "", token)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if idf != want {
+			t.Fatalf("idf %s: %d want %d", token, idf, want)
+		}
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("b"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 0 {
+		t.Fatalf("stale token matched: %+v", hits.Docs)
+	}
+}
+
+func TestFulltextPhrase(t *testing.T) {
+	index := "phrase"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	docs := make(map[string]string)
+
+	docs["document_0"] = "okapi bm25 is a ranking function"
+	docs["document_1"] = "bm25 okapi"
+	docs["document_2"] = "the okapi system uses bm25"
+	docs["document_3"] = "okapi information retrieval system"
+
+	err = fulltext.AddDocs(index, docs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cases := []struct {
+		query *Query
+		ids   []string
+	}{
+		{new(Query).Index(index).Phrase("okapi bm25"), []string{"document_0"}},
+		{new(Query).Index(index).Near(0, "okapi", "bm25"), []string{"document_0", "document_1"}},
+		{new(Query).Index(index).Near(2, "okapi", "bm25"), []string{"document_0", "document_1", "document_2"}},
+		{new(Query).Index(index).Match("okapi").Phrase("bm25 okapi"), []string{"document_1"}},
+		{new(Query).Index(index).Phrase("okapi retrieval"), nil},
+	}
+
+	for _, c := range cases {
+		hits, err := fulltext.Search(c.query)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ids := make(map[string]struct{})
+		for _, doc := range hits.Docs {
+			ids[doc.ID] = struct{}{}
+		}
+		if len(ids) != len(c.ids) {
+			t.Fatalf("%+v: %+v", c.query, hits.Docs)
+		}
+		for _, id := range c.ids {
+			if _, exist := ids[id]; !exist {
+				t.Fatalf("%+v: %+v", c.query, hits.Docs)
+			}
+		}
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("okapi bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	boosted, err := fulltext.Search(new(Query).Index(index).Match("okapi bm25").PhraseBoost(2))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if boosted.Total != hits.Total || boosted.Docs[0].ID != "document_0" || boosted.Docs[0].Score <= hits.Docs[0].Score {
+		t.Fatalf("phrase boost: %+v %+v", hits.Docs, boosted.Docs)
+	}
+}
+
 func TestFulltextCh(t *testing.T) {
 	index := "ch"
 
@@ -0,0 +1,268 @@
+package fulltext
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// AutoFuzziness lets the length of a term choose its edits: none up to 2
+// characters, 1 up to 5 and 2 over.
+const AutoFuzziness = -1
+
+// maxFuzziness bounds the edits, past 2 nearly every term matches.
+const maxFuzziness = 2
+
+// fuzzy is a clause matching the terms within edits of term.
+type fuzzy struct {
+	term  string
+	edits int
+}
+
+// fuzzyTerm is a term of the index within edits of a fuzzy term.
+type fuzzyTerm struct {
+	term  string
+	edits int
+	df    uint32
+}
+
+// Fuzzy requires a term within maxEdits insertions, deletions or
+// substitutions of term, at most 2, or AutoFuzziness. The closest and most
+// frequent terms are kept, as many as the expansions of the query, and
+// scored like terms with the frequency of the most frequent one, boosted
+// down by their edits. Like Prefix, term is not analysed.
+func (query *Query) Fuzzy(term string, maxEdits int) *Query {
+	query.fuzzies = append(query.fuzzies, fuzzy{term, maxEdits})
+	return query
+}
+
+// Fuzziness makes the tokens of Match also match the terms within maxEdits
+// of them, or AutoFuzziness.
+func (query *Query) Fuzziness(maxEdits int) *Query {
+	query.fuzziness = maxEdits
+	return query
+}
+
+// FuzzyOptions sets the number of leading characters a fuzzy term must
+// match exactly, 0 by default, and whether swapping two adjacent characters
+// is a single edit, as by default, or two.
+func (query *Query) FuzzyOptions(prefixLength int, transpositions bool) *Query {
+	query.fuzzyPrefix = prefixLength
+	query.noTranspositions = !transpositions
+	return query
+}
+
+// fuzzyEdits returns the edits allowed for term.
+func fuzzyEdits(term string, edits int) int {
+	if edits == AutoFuzziness {
+		switch l := utf8.RuneCountInString(term); {
+		case l <= 2:
+			return 0
+		case l <= 5:
+			return 1
+		}
+		return 2
+	}
+	if edits < 0 {
+		return 0
+	}
+	if edits > maxFuzziness {
+		return maxFuzziness
+	}
+	return edits
+}
+
+// fuzzyTerms calls fn with the terms of field within edits of term that
+// start with its prefixLength first characters. The sorted terms are walked
+// by a Levenshtein automaton: the rows of the distance matrix are shared by
+// the terms with a common prefix, and once every cell of a row is over
+// edits, the terms starting with that prefix are skipped with a seek.
+func (r reader) fuzzyTerms(i, field, term string, edits, prefixLength int, transpositions bool, fn func(term string, edits int, df uint32)) error {
+	runes := []rune(term)
+	if prefixLength > len(runes) {
+		prefixLength = len(runes)
+	}
+	exact := string(runes[:prefixLength])
+	p := runes[prefixLength:]
+
+	key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, fieldKind(idfKey, field), exact))
+	l := len(key)
+
+	// rows[k] holds the distances of the k first runes of done to the
+	// prefixes of p
+	first := make([]int, len(p)+1)
+	for j := range first {
+		first[j] = j
+	}
+	rows := [][]int{first}
+	var done []rune
+
+	iter := r.NewIterator(key)
+	ok := iter.Next()
+	for ok {
+		rest := []rune(string(iter.Key()[l:]))
+
+		common := 0
+		for common < len(rest) && common < len(done) && rest[common] == done[common] {
+			common++
+		}
+		rows = rows[:common+1]
+
+		dead := -1
+		for k := common + 1; k <= len(rest); k++ {
+			row := nextRow(rows, rest, p, k, transpositions)
+			rows = append(rows, row)
+			if minInt(row) > edits {
+				dead = k
+				break
+			}
+		}
+
+		if dead >= 0 {
+			// no term starting with rest[:dead] is close enough, 0xff is
+			// after any of them as it is never part of UTF-8
+			done = rest[:dead]
+			skip := append(append(key[:l:l], string(done)...), 0xff)
+			ok = iter.Seek(skip)
+			continue
+		}
+
+		done = rest
+		if d := rows[len(rest)][len(p)]; d <= edits {
+			fn(exact+string(rest), d, byteToUint32(iter.Value()))
+		}
+		ok = iter.Next()
+	}
+	iter.Release()
+
+	return iter.Error()
+}
+
+// nextRow computes the distances of the k first runes of s to the prefixes
+// of p from the rows of the shorter prefixes of s. A transposition is the
+// optimal string alignment distance of Damerau.
+func nextRow(rows [][]int, s, p []rune, k int, transpositions bool) []int {
+	prev := rows[k-1]
+	row := make([]int, len(p)+1)
+	row[0] = k
+	c := s[k-1]
+	for j := 1; j <= len(p); j++ {
+		cost := 1
+		if p[j-1] == c {
+			cost = 0
+		}
+		d := prev[j-1] + cost
+		if prev[j]+1 < d {
+			d = prev[j] + 1
+		}
+		if row[j-1]+1 < d {
+			d = row[j-1] + 1
+		}
+		if transpositions && k > 1 && j > 1 && c == p[j-2] && s[k-2] == p[j-1] && rows[k-2][j-2]+1 < d {
+			d = rows[k-2][j-2] + 1
+		}
+		row[j] = d
+	}
+	return row
+}
+
+func minInt(row []int) int {
+	min := row[0]
+	for _, v := range row[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// fuzzyExpand returns the terms of fields within edits of term, at most max
+// of them, the closest first, then the most frequent. A term is not kept
+// when the edits change all of the shorter of the two.
+func fuzzyExpand(r reader, i string, fields []string, term string, edits, max, prefixLength int, transpositions bool) ([]fuzzyTerm, error) {
+	if max <= 0 {
+		max = DefaultMaxExpansions
+	}
+	l := utf8.RuneCountInString(term)
+
+	found := make(map[string]fuzzyTerm)
+	for _, field := range fields {
+		err := r.fuzzyTerms(i, field, term, edits, prefixLength, transpositions, func(t string, d int, df uint32) {
+			if d > 0 && (d >= l || d >= utf8.RuneCountInString(t)) {
+				return
+			}
+			if old, exist := found[t]; !exist || df > old.df {
+				found[t] = fuzzyTerm{t, d, df}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	terms := make([]fuzzyTerm, 0, len(found))
+	for _, ft := range found {
+		terms = append(terms, ft)
+	}
+	sort.Slice(terms, func(a, b int) bool {
+		if terms[a].edits != terms[b].edits {
+			return terms[a].edits < terms[b].edits
+		}
+		if terms[a].df != terms[b].df {
+			return terms[a].df > terms[b].df
+		}
+		return terms[a].term < terms[b].term
+	})
+	if len(terms) > max {
+		terms = terms[:max]
+	}
+
+	return terms, nil
+}
+
+// fuzzyTF loads the postings of the terms within edits of term. They share
+// the largest document frequency and are boosted by 1 - edits / length, the
+// length of the shorter of the term and the fuzzy one.
+func fuzzyTF(r reader, i string, fields []string, term string, edits int, query *Query) ([]tokenTFIDF, error) {
+	edits = fuzzyEdits(term, edits)
+	if edits == 0 {
+		tfidf, err := termTF(r, i, fields, term)
+		if err != nil || tfidf == nil {
+			return nil, err
+		}
+		return []tokenTFIDF{*tfidf}, nil
+	}
+
+	terms, err := fuzzyExpand(r, i, fields, term, edits, query.maxExpansions, query.fuzzyPrefix, !query.noTranspositions)
+	if err != nil {
+		return nil, err
+	}
+
+	l := utf8.RuneCountInString(term)
+	var tfidfs []tokenTFIDF
+	var maxIDF uint32
+	for _, ft := range terms {
+		tfidf, err := termTF(r, i, fields, ft.term)
+		if err != nil {
+			return nil, err
+		}
+		if tfidf == nil {
+			continue
+		}
+
+		shorter := utf8.RuneCountInString(ft.term)
+		if l < shorter {
+			shorter = l
+		}
+		tfidf.boost = 1 - float32(ft.edits)/float32(shorter)
+		if tfidf.tokenIDF > maxIDF {
+			maxIDF = tfidf.tokenIDF
+		}
+		tfidfs = append(tfidfs, *tfidf)
+	}
+	for k := range tfidfs {
+		tfidfs[k].tokenIDF = maxIDF
+	}
+
+	return tfidfs, nil
+}
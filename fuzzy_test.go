@@ -0,0 +1,153 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// osa is the optimal string alignment distance, computed the plain way.
+func osa(a, b []rune, transpositions bool) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt([]int{d[i-1][j] + 1, d[i][j-1] + 1, d[i-1][j-1] + cost})
+			if transpositions && i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt([]int{d[i][j], d[i-2][j-2] + 1})
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func TestFuzzyTerms(t *testing.T) {
+	index := "fuzzy"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	rnd := rand.New(rand.NewSource(1))
+	word := func() string {
+		b := make([]byte, 1+rnd.Intn(6))
+		for k := range b {
+			b[k] = "abcde"[rnd.Intn(5)]
+		}
+		return string(b)
+	}
+	words := make([]string, 300)
+	for k := range words {
+		words[k] = word()
+	}
+	if err = fulltext.AddDocs(index, map[string]string{"document_0": strings.Join(words, " ")}); err != nil {
+		log.Fatal(err)
+	}
+
+	r := reader{fulltext.db}
+	for n := 0; n < 50; n++ {
+		term, edits, prefix, transpositions := word(), rnd.Intn(3), rnd.Intn(2), rnd.Intn(2) == 0
+
+		var got []string
+		err := r.fuzzyTerms(index, "", term, edits, prefix, transpositions, func(w string, d int, df uint32) {
+			if d != osa([]rune(w), []rune(term), transpositions) || df != 1 {
+				t.Fatalf("%s: %d, df %d", w, d, df)
+			}
+			got = append(got, w)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var want []string
+		seen := make(map[string]struct{})
+		for _, w := range words {
+			if _, exist := seen[w]; exist || !strings.HasPrefix(w, term[:prefix]) {
+				continue
+			}
+			seen[w] = struct{}{}
+			if osa([]rune(w), []rune(term), transpositions) <= edits {
+				want = append(want, w)
+			}
+		}
+		sort.Strings(want)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%q edits %d prefix %d transpositions %v: %v, want %v", term, edits, prefix, transpositions, got, want)
+		}
+	}
+}
+
+func TestFulltextFuzzy(t *testing.T) {
+	index := "fuzzy"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	docs := map[string]string{
+		"document_0": "information retrieval",
+		"document_1": "retrieval of information",
+		"document_2": "information theory",
+	}
+	if err = fulltext.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+
+	ids := func(query *Query) []string {
+		hits, err := fulltext.Search(query.Index(index))
+		if err != nil {
+			log.Fatal(err)
+		}
+		var ids []string
+		for _, doc := range hits.Docs {
+			ids = append(ids, doc.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	retrieval := []string{"document_0", "document_1"}
+	if got := ids(new(Query).Fuzzy("retreival", 1)); !reflect.DeepEqual(got, retrieval) {
+		t.Fatalf("transposition: %v", got)
+	}
+	if got := ids(new(Query).Fuzzy("retreival", 1).FuzzyOptions(0, false)); len(got) != 0 {
+		t.Fatalf("no transposition: %v", got)
+	}
+	if got := ids(new(Query).Fuzzy("xetrieval", 1)); !reflect.DeepEqual(got, retrieval) {
+		t.Fatalf("substitution: %v", got)
+	}
+	if got := ids(new(Query).Fuzzy("xetrieval", 1).FuzzyOptions(1, true)); len(got) != 0 {
+		t.Fatalf("prefix: %v", got)
+	}
+	if got := ids(new(Query).Match("retrievl")); len(got) != 0 {
+		t.Fatalf("exact match: %v", got)
+	}
+	if got := ids(new(Query).Match("retrievl").Fuzziness(AutoFuzziness)); !reflect.DeepEqual(got, retrieval) {
+		t.Fatalf("fuzzy match: %v", got)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("informaton theory").Fuzziness(AutoFuzziness))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 3 || hits.Docs[0].ID != "document_2" {
+		t.Fatalf("fuzzy scores: %+v", hits)
+	}
+}
@@ -0,0 +1,68 @@
+package fulltext
+
+// GetDoc returns the stored fields of a document, nil if the document is
+// unknown or the mapping of index stores none of its fields.
+func (fulltext *Fulltext) GetDoc(index, id string) (*Document, error) {
+	fields, err := reader{fulltext.db}.src(index, id)
+	if err != nil || fields == nil {
+		return nil, err
+	}
+
+	return &Document{ID: id, Fields: fields}, nil
+}
+
+// MultiGetDocs is GetDoc for several ids. The result follows the order of
+// ids and holds nil for the documents GetDoc would not return.
+func (fulltext *Fulltext) MultiGetDocs(index string, ids ...string) ([]*Document, error) {
+	snap, err := fulltext.db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	r := reader{snap}
+
+	docs := make([]*Document, len(ids))
+	for k, id := range ids {
+		fields, err := r.src(index, id)
+		if err != nil {
+			return nil, err
+		}
+		if fields != nil {
+			docs[k] = &Document{ID: id, Fields: fields}
+		}
+	}
+
+	return docs, nil
+}
+
+// Source returns the stored fields with every hit, only the named ones if any.
+func (query *Query) Source(fields ...string) *Query {
+	query.source = true
+	query.sourceFields = fields
+	return query
+}
+
+func (r reader) fillSource(i string, docs []Doc, names []string) error {
+	for k := range docs {
+		fields, err := r.src(i, docs[k].ID)
+		if err != nil {
+			return err
+		}
+		if fields == nil {
+			continue
+		}
+
+		if len(names) != 0 {
+			picked := make(map[string][]string, len(names))
+			for _, name := range names {
+				if values, exist := fields[name]; exist {
+					picked[name] = values
+				}
+			}
+			fields = picked
+		}
+		docs[k].Fields = fields
+	}
+
+	return nil
+}
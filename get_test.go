@@ -0,0 +1,70 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"testing"
+)
+
+func TestFulltextSource(t *testing.T) {
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.PutMapping("stored", Mapping{Fields: map[string]FieldMapping{
+		"title": {Type: FieldText, Store: true},
+		"body":  {Type: FieldText},
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = fulltext.AddDocuments("stored",
+		NewDocument("document_0").Add("title", "okapi bm25").Add("body", "a ranking function"),
+		NewDocument("document_1").Add("body", "nothing stored"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	docs, err := fulltext.MultiGetDocs("stored", "document_0", "document_1", "document_2")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(docs) != 3 || docs[0] == nil || docs[1] != nil || docs[2] != nil {
+		t.Fatalf("multi get: %v", docs)
+	}
+	if len(docs[0].Fields) != 1 || docs[0].Fields["title"][0] != "okapi bm25" {
+		t.Fatalf("stored fields: %v", docs[0].Fields)
+	}
+
+	err = fulltext.PutMapping("source", Mapping{Source: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = fulltext.AddDocs("source", map[string]string{"document_0": "okapi bm25", "document_1": "tf idf"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index("source").Match("bm25").Source())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 1 || hits.Docs[0].Fields[""][0] != "okapi bm25" {
+		t.Fatalf("hits: %+v", hits.Docs)
+	}
+
+	err = fulltext.DelDocs("source", "document_0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	doc, err := fulltext.GetDoc("source", "document_0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if doc != nil {
+		t.Fatalf("deleted doc: %+v", doc)
+	}
+}
@@ -6,7 +6,8 @@ require (
 	github.com/go-ego/gse v0.80.2
 	github.com/nextzhou/workpool v1.5.0
 	github.com/syndtr/goleveldb v1.0.0
-	golang.org/x/sync v0.1.0
+	golang.org/x/sync v0.7.0
+	golang.org/x/text v0.16.0
 )
 
 require (
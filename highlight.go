@@ -0,0 +1,313 @@
+package fulltext
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Highlighter cuts the parts of a text that match a query into fragments and
+// wraps the matched tokens in tags.
+type Highlighter struct {
+	PreTag  string
+	PostTag string
+	// FragmentSize is the length of a fragment in characters. With 0 the
+	// whole text is a single fragment.
+	FragmentSize int
+	// Fragments is the number of fragments returned at most, best first.
+	Fragments int
+}
+
+type span struct {
+	start int
+	end   int
+	terms []string
+}
+
+type fragment struct {
+	start int
+	end   int
+	spans []span
+	score float32
+}
+
+func NewHighlighter() *Highlighter {
+	return &Highlighter{
+		PreTag:       "<em>",
+		PostTag:      "</em>",
+		FragmentSize: 100,
+		Fragments:    3,
+	}
+}
+
+// Highlight returns the best fragments of text containing terms, compared
+// with the tokens tokenizer cuts text into. It returns nil when no term occurs.
+func Highlight(tokenizer Tokenizer, text string, terms []string, h *Highlighter) []string {
+	return highlight(&Analyzer{Tokenizer: tokenizer}, text, termSet(terms), h)
+}
+
+// Highlight highlights the tokens of query in text, both analysed by the
+// default analyzer. The fragments are cut from the char filtered text.
+func (fulltext *Fulltext) Highlight(text, query string, h *Highlighter) []string {
+	analyzer := fulltext.defaultAnalyzer
+	return highlight(analyzer, text, termSet(analyzer.terms(query)), h)
+}
+
+// Highlight adds the highlighted fragments of the stored fields to every hit,
+// of the named fields only if any.
+func (query *Query) Highlight(h *Highlighter, fields ...string) *Query {
+	if h == nil {
+		h = NewHighlighter()
+	}
+	query.highlighter = h
+	query.highlightFields = fields
+	return query
+}
+
+func highlight(analyzer *Analyzer, text string, terms map[string]struct{}, h *Highlighter) []string {
+	if h == nil {
+		h = NewHighlighter()
+	}
+
+	text, tokens, _ := analyzer.analyze(text)
+	spans := spansOf(tokens, terms)
+	if len(spans) == 0 {
+		return nil
+	}
+
+	return h.render(text, spans)
+}
+
+func termSet(terms []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(terms))
+	for _, term := range terms {
+		set[term] = struct{}{}
+	}
+	return set
+}
+
+// highlightTerms lists every token the query looks for in the fields
+// analysed by analyzer.
+func highlightTerms(analyzer *Analyzer, query *Query) map[string]struct{} {
+	var terms []string
+	if clause := query.clause(); clause != nil {
+		terms = clauseTerms(analyzer, clause, terms)
+	}
+	return termSet(terms)
+}
+
+// clauseTerms appends the tokens a clause and the clauses it requires or
+// prefers look for to terms.
+func clauseTerms(analyzer *Analyzer, clause Clause, terms []string) []string {
+	switch c := clause.(type) {
+	case *Query:
+		if clause := c.clause(); clause != nil {
+			terms = clauseTerms(analyzer, clause, terms)
+		}
+	case *BoolClause:
+		for _, clauses := range [][]Clause{c.Must, c.Filter, c.Should} {
+			for _, sub := range clauses {
+				terms = clauseTerms(analyzer, sub, terms)
+			}
+		}
+	case *MatchClause:
+		terms = append(terms, analyzer.terms(c.Text)...)
+	case *tokenClause:
+		if term, ok := analyzer.normalize(c.token); ok {
+			terms = append(terms, term)
+		}
+	case *PhraseClause:
+		for _, str := range c.Terms {
+			if term, ok := analyzer.normalize(str); ok {
+				terms = append(terms, term)
+			}
+		}
+		terms = append(terms, analyzer.terms(c.Text)...)
+	case *TermClause:
+		terms = append(terms, c.Value)
+	}
+	return terms
+}
+
+func (fulltext *Fulltext) fillHighlights(r reader, query *Query, mapping *Mapping, docs []Doc) error {
+	termSets := make(map[*Analyzer]map[string]struct{})
+
+	for k := range docs {
+		fields, err := r.src(query.index, docs[k].ID)
+		if err != nil {
+			return err
+		}
+
+		names := query.highlightFields
+		if len(names) == 0 {
+			for name := range fields {
+				names = append(names, name)
+			}
+		}
+
+		for _, name := range names {
+			analyzer, err := fulltext.analyzer(mapping, name)
+			if err != nil {
+				return err
+			}
+			terms, exist := termSets[analyzer]
+			if !exist {
+				terms = highlightTerms(analyzer, query)
+				termSets[analyzer] = terms
+			}
+
+			var fragments []string
+			for _, value := range fields[name] {
+				if mapping.field(name).Type != FieldKeyword {
+					fragments = append(fragments, highlight(analyzer, value, terms, query.highlighter)...)
+					continue
+				}
+				if _, exist := terms[value]; exist {
+					fragments = append(fragments, query.highlighter.render(value, []span{{0, len(value), []string{value}}})...)
+				}
+			}
+			if len(fragments) == 0 {
+				continue
+			}
+			if n := query.highlighter.Fragments; n > 0 && len(fragments) > n {
+				fragments = fragments[:n]
+			}
+
+			if docs[k].Highlights == nil {
+				docs[k].Highlights = make(map[string][]string)
+			}
+			docs[k].Highlights[name] = fragments
+		}
+	}
+
+	return nil
+}
+
+// spansOf returns the merged spans of the tokens in terms.
+func spansOf(tokens []Token, terms map[string]struct{}) []span {
+	var spans []span
+	for _, token := range tokens {
+		if token.Start < 0 {
+			continue
+		}
+		if _, exist := terms[token.Term]; exist {
+			spans = append(spans, span{token.Start, token.End, []string{token.Term}})
+		}
+	}
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		prev := &merged[len(merged)-1]
+		if s.start < prev.end {
+			if s.end > prev.end {
+				prev.end = s.end
+			}
+			prev.terms = append(prev.terms, s.terms...)
+			continue
+		}
+		merged = append(merged, s)
+	}
+
+	return merged
+}
+
+func (h *Highlighter) render(text string, spans []span) []string {
+	frags := h.fragments(text, spans)
+
+	sort.SliceStable(frags, func(i, j int) bool { return frags[i].score > frags[j].score })
+	if h.Fragments > 0 && len(frags) > h.Fragments {
+		frags = frags[:h.Fragments]
+	}
+
+	ret := make([]string, 0, len(frags))
+	for _, f := range frags {
+		var b strings.Builder
+		at := f.start
+		for _, s := range f.spans {
+			b.WriteString(text[at:s.start])
+			b.WriteString(h.PreTag)
+			b.WriteString(text[s.start:s.end])
+			b.WriteString(h.PostTag)
+			at = s.end
+		}
+		b.WriteString(text[at:f.end])
+		ret = append(ret, strings.TrimSpace(b.String()))
+	}
+
+	return ret
+}
+
+// fragments cuts text into pieces of about FragmentSize characters, preferably
+// after a space or a punctuation mark and never inside a span, and scores the
+// ones holding spans by their distinct terms.
+func (h *Highlighter) fragments(text string, spans []span) []fragment {
+	var frags []fragment
+	start := 0
+	for start < len(text) {
+		end := len(text)
+		if h.FragmentSize > 0 {
+			end = cut(text, start, h.FragmentSize)
+		}
+		for _, s := range spans {
+			if s.start < end && end < s.end {
+				end = s.end
+			}
+		}
+
+		f := fragment{start: start, end: end}
+		seen := make(map[string]struct{})
+		for _, s := range spans {
+			if s.start >= start && s.end <= end {
+				f.spans = append(f.spans, s)
+				for _, term := range s.terms {
+					if _, exist := seen[term]; !exist {
+						seen[term] = struct{}{}
+						f.score++
+					}
+				}
+				f.score += 0.1
+			}
+		}
+		if len(f.spans) != 0 {
+			frags = append(frags, f)
+		}
+
+		start = end
+	}
+
+	return frags
+}
+
+// cut returns where the fragment starting at start ends: after size
+// characters, moved back to the last break in its final third if there is one.
+func cut(text string, start, size int) int {
+	end := start
+	for n := 0; n < size && end < len(text); n++ {
+		_, w := utf8.DecodeRuneInString(text[end:])
+		end += w
+	}
+	if end == len(text) {
+		return end
+	}
+
+	min := start
+	for n := 0; n < size*2/3; n++ {
+		_, w := utf8.DecodeRuneInString(text[min:])
+		min += w
+	}
+	for at := end; at > min; {
+		c, w := utf8.DecodeLastRuneInString(text[:at])
+		if unicode.IsSpace(c) || unicode.IsPunct(c) {
+			return at
+		}
+		at -= w
+	}
+
+	return end
+}
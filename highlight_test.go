@@ -0,0 +1,67 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"strings"
+	"testing"
+)
+
+type fixedTokenizer []string
+
+func (f fixedTokenizer) Seg(text string) []string {
+	return f
+}
+
+func TestHighlight(t *testing.T) {
+	h := NewHighlighter()
+
+	frags := Highlight(&seg.EnTokenizer{}, "Okapi BM25 is a ranking function. BM25 ranks documents", []string{"BM25", "ranks"}, h)
+	if len(frags) != 1 || frags[0] != "Okapi <em>BM25</em> is a ranking function. <em>BM25</em> <em>ranks</em> documents" {
+		t.Fatalf("en: %q", frags)
+	}
+
+	// search mode segmentation emits the parts of a word before the word
+	tokenizer := fixedTokenizer{"在", "信息", "检索", "信息检索", "中", "，", "搜索", "索引", "引擎", "搜索引擎"}
+	frags = Highlight(tokenizer, "在信息检索中，搜索引擎", []string{"检索", "搜索引擎"}, h)
+	if len(frags) != 1 || frags[0] != "在信息<em>检索</em>中，<em>搜索引擎</em>" {
+		t.Fatalf("ch: %q", frags)
+	}
+
+	h.FragmentSize = 20
+	h.Fragments = 1
+	text := "nothing to see here at all. the bm25 function and bm25 variants. bm25 again"
+	frags = Highlight(&seg.EnTokenizer{}, text, []string{"bm25", "variants."}, h)
+	if len(frags) != 1 || !strings.Contains(frags[0], "<em>variants.</em>") {
+		t.Fatalf("best fragment: %q", frags)
+	}
+
+	if frags = Highlight(&seg.EnTokenizer{}, text, []string{"okapi"}, h); frags != nil {
+		t.Fatalf("no match: %q", frags)
+	}
+}
+
+func TestFulltextHighlight(t *testing.T) {
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.PutMapping("highlight", Mapping{Source: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = fulltext.AddDocuments("highlight", NewDocument("document_0").Add("title", "okapi bm25").Add("body", "bm25 is a ranking function"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index("highlight").Match("bm25").Highlight(nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 1 || hits.Docs[0].Highlights["title"][0] != "okapi <em>bm25</em>" || hits.Docs[0].Highlights["body"][0] != "<em>bm25</em> is a ranking function" {
+		t.Fatalf("hits: %+v", hits.Docs)
+	}
+}
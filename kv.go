@@ -0,0 +1,44 @@
+package fulltext
+
+// KVReader is the read side of a KV store.
+type KVReader interface {
+	// Get returns a nil value and a nil error when key does not exist.
+	Get(key []byte) ([]byte, error)
+	// NewIterator iterates the keys starting with prefix in byte order.
+	NewIterator(prefix []byte) Iterator
+}
+
+// KV is an ordered key-value store the indexes are kept in.
+type KV interface {
+	KVReader
+	NewBatch() Batch
+	// Write applies the batch atomically.
+	Write(batch Batch) error
+	// WriteSync is Write, returning once the batch and every write before it
+	// are durable.
+	WriteSync(batch Batch) error
+	// Snapshot returns a consistent read-only view of the store.
+	Snapshot() (Snapshot, error)
+	Close() error
+}
+
+type Snapshot interface {
+	KVReader
+	Release()
+}
+
+type Batch interface {
+	Put(key, value []byte)
+	Delete(key []byte)
+	Len() int
+	Reset()
+}
+
+type Iterator interface {
+	Next() bool
+	Seek(key []byte) bool
+	Key() []byte
+	Value() []byte
+	Release()
+	Error() error
+}
@@ -0,0 +1,85 @@
+package fulltext
+
+import (
+	"errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+type levelKV struct {
+	db *leveldb.DB
+}
+
+// NewLevelKV opens or creates a goleveldb store at dbPath.
+func NewLevelKV(dbPath string, o *opt.Options) (KV, error) {
+	db, err := leveldb.OpenFile(dbPath, o)
+	if err != nil {
+		return nil, err
+	}
+	return &levelKV{db: db}, nil
+}
+
+func (kv *levelKV) Get(key []byte) ([]byte, error) {
+	val, err := kv.db.Get(key, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	return val, err
+}
+
+func (kv *levelKV) NewIterator(prefix []byte) Iterator {
+	return kv.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (kv *levelKV) NewBatch() Batch {
+	return new(leveldb.Batch)
+}
+
+func (kv *levelKV) Write(batch Batch) error {
+	b, ok := batch.(*leveldb.Batch)
+	if !ok {
+		return errors.New("fulltext/kv: batch not created by this store")
+	}
+	return kv.db.Write(b, nil)
+}
+
+func (kv *levelKV) WriteSync(batch Batch) error {
+	b, ok := batch.(*leveldb.Batch)
+	if !ok {
+		return errors.New("fulltext/kv: batch not created by this store")
+	}
+	return kv.db.Write(b, &opt.WriteOptions{Sync: true})
+}
+
+func (kv *levelKV) Snapshot() (Snapshot, error) {
+	snap, err := kv.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &levelSnapshot{snap: snap}, nil
+}
+
+func (kv *levelKV) Close() error {
+	return kv.db.Close()
+}
+
+type levelSnapshot struct {
+	snap *leveldb.Snapshot
+}
+
+func (s *levelSnapshot) Get(key []byte) ([]byte, error) {
+	val, err := s.snap.Get(key, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	return val, err
+}
+
+func (s *levelSnapshot) NewIterator(prefix []byte) Iterator {
+	return s.snap.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (s *levelSnapshot) Release() {
+	s.snap.Release()
+}
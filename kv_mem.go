@@ -0,0 +1,293 @@
+package fulltext
+
+import (
+	"errors"
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+// memKV keeps everything in memory. The keys are in a persistent treap:
+// every write copies the paths to the keys it changes into a new immutable
+// state, so writes cost O(log N) a key, and snapshots and iterators are free
+// and never see later writes.
+type memKV struct {
+	mutex sync.RWMutex
+	state *memState
+}
+
+type memState struct {
+	root *memNode
+}
+
+// memNode is never modified once in a state. Its priority is a hash of its
+// key, the treap is a heap of them, which keeps it balanced whatever the
+// order the keys are written in.
+type memNode struct {
+	key      string
+	val      []byte
+	priority uint64
+	left     *memNode
+	right    *memNode
+}
+
+type memOp struct {
+	key []byte
+	val []byte
+	del bool
+}
+
+type memBatch struct {
+	ops []memOp
+}
+
+// NewMemKV returns an empty in-memory store.
+func NewMemKV() KV {
+	return &memKV{state: new(memState)}
+}
+
+func (kv *memKV) current() *memState {
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+	return kv.state
+}
+
+func (kv *memKV) Get(key []byte) ([]byte, error) {
+	return kv.current().Get(key)
+}
+
+func (kv *memKV) NewIterator(prefix []byte) Iterator {
+	return kv.current().NewIterator(prefix)
+}
+
+func (kv *memKV) NewBatch() Batch {
+	return new(memBatch)
+}
+
+func (kv *memKV) Write(batch Batch) error {
+	b, ok := batch.(*memBatch)
+	if !ok {
+		return errors.New("fulltext/kv: batch not created by this store")
+	}
+
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	root := kv.state.root
+	for _, op := range b.ops {
+		if op.del {
+			root = root.remove(string(op.key))
+		} else {
+			root = root.insert(string(op.key), op.val, priority(op.key))
+		}
+	}
+
+	kv.state = &memState{root: root}
+	return nil
+}
+
+// WriteSync is Write, a memory store has nothing to sync.
+func (kv *memKV) WriteSync(batch Batch) error {
+	return kv.Write(batch)
+}
+
+func (kv *memKV) Snapshot() (Snapshot, error) {
+	return kv.current(), nil
+}
+
+func (kv *memKV) Close() error {
+	return nil
+}
+
+func (s *memState) Get(key []byte) ([]byte, error) {
+	k := string(key)
+	for n := s.root; n != nil; {
+		switch {
+		case k < n.key:
+			n = n.left
+		case k > n.key:
+			n = n.right
+		default:
+			return n.val, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memState) Release() {}
+
+func (s *memState) NewIterator(prefix []byte) Iterator {
+	return &memIterator{root: s.root, prefix: string(prefix)}
+}
+
+func priority(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// insert returns the treap n with key set to val, copying the nodes on the
+// path to key.
+func (n *memNode) insert(key string, val []byte, priority uint64) *memNode {
+	if n == nil {
+		return &memNode{key: key, val: val, priority: priority}
+	}
+
+	c := *n
+	switch {
+	case key < n.key:
+		c.left = n.left.insert(key, val, priority)
+		if c.left.priority > c.priority {
+			// rotate right, both nodes are copies
+			l := c.left
+			c.left, l.right = l.right, &c
+			return l
+		}
+	case key > n.key:
+		c.right = n.right.insert(key, val, priority)
+		if c.right.priority > c.priority {
+			r := c.right
+			c.right, r.left = r.left, &c
+			return r
+		}
+	default:
+		c.val = val
+	}
+	return &c
+}
+
+// remove returns the treap n without key, n itself when key is not in it.
+func (n *memNode) remove(key string) *memNode {
+	if n == nil {
+		return nil
+	}
+
+	switch {
+	case key < n.key:
+		left := n.left.remove(key)
+		if left == n.left {
+			return n
+		}
+		c := *n
+		c.left = left
+		return &c
+	case key > n.key:
+		right := n.right.remove(key)
+		if right == n.right {
+			return n
+		}
+		c := *n
+		c.right = right
+		return &c
+	}
+	return merge(n.left, n.right)
+}
+
+// merge joins the treaps a and b, the keys of a being before the ones of b.
+func merge(a, b *memNode) *memNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	if a.priority > b.priority {
+		c := *a
+		c.right = merge(a.right, b)
+		return &c
+	}
+	c := *b
+	c.left = merge(a, b.left)
+	return &c
+}
+
+func (b *memBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, memOp{key: append([]byte(nil), key...), val: append([]byte(nil), value...)})
+}
+
+func (b *memBatch) Delete(key []byte) {
+	b.ops = append(b.ops, memOp{key: append([]byte(nil), key...), del: true})
+}
+
+func (b *memBatch) Len() int {
+	return len(b.ops)
+}
+
+func (b *memBatch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// memIterator walks the keys with prefix in order. Its stack holds the
+// nodes whose key comes next, the deepest last.
+type memIterator struct {
+	root    *memNode
+	prefix  string
+	stack   []*memNode
+	node    *memNode
+	started bool
+	done    bool
+}
+
+func (it *memIterator) Next() bool {
+	if !it.started {
+		return it.Seek([]byte(it.prefix))
+	}
+	if it.done {
+		return false
+	}
+	for n := it.node.right; n != nil; n = n.left {
+		it.stack = append(it.stack, n)
+	}
+	return it.pop()
+}
+
+func (it *memIterator) Seek(key []byte) bool {
+	k := string(key)
+	if k < it.prefix {
+		k = it.prefix
+	}
+
+	it.started, it.done = true, false
+	it.stack = it.stack[:0]
+	for n := it.root; n != nil; {
+		if n.key >= k {
+			it.stack = append(it.stack, n)
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return it.pop()
+}
+
+// pop moves to the node on top of the stack, if it still has the prefix.
+func (it *memIterator) pop() bool {
+	if len(it.stack) == 0 || !strings.HasPrefix(it.stack[len(it.stack)-1].key, it.prefix) {
+		it.node, it.done = nil, true
+		return false
+	}
+	it.node = it.stack[len(it.stack)-1]
+	it.stack = it.stack[:len(it.stack)-1]
+	return true
+}
+
+func (it *memIterator) Key() []byte {
+	if it.node == nil {
+		return nil
+	}
+	return []byte(it.node.key)
+}
+
+func (it *memIterator) Value() []byte {
+	if it.node == nil {
+		return nil
+	}
+	return it.node.val
+}
+
+func (it *memIterator) Release() {}
+
+func (it *memIterator) Error() error {
+	return nil
+}
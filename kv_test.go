@@ -0,0 +1,178 @@
+package fulltext
+
+import (
+	"fmt"
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testKV(t *testing.T, kv KV) {
+	batch := kv.NewBatch()
+	batch.Put([]byte("index:a:tf:b"), []byte("2"))
+	batch.Put([]byte("index:a:tf:a"), []byte("1"))
+	batch.Put([]byte("index:b:tf:a"), []byte("3"))
+	if err := kv.Write(batch); err != nil {
+		log.Fatal(err)
+	}
+
+	snap, err := kv.Snapshot()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer snap.Release()
+
+	batch = kv.NewBatch()
+	batch.Delete([]byte("index:a:tf:a"))
+	batch.Put([]byte("index:a:tf:c"), []byte("4"))
+	if err := kv.WriteSync(batch); err != nil {
+		log.Fatal(err)
+	}
+
+	keys := func(r KVReader, prefix string) []string {
+		var ks []string
+		iter := r.NewIterator([]byte(prefix))
+		for iter.Next() {
+			ks = append(ks, string(iter.Key())+"="+string(iter.Value()))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			log.Fatal(err)
+		}
+		return ks
+	}
+
+	if ks := keys(kv, "index:a:"); len(ks) != 2 || ks[0] != "index:a:tf:b=2" || ks[1] != "index:a:tf:c=4" {
+		t.Fatalf("kv: %v", ks)
+	}
+	if ks := keys(snap, "index:a:"); len(ks) != 2 || ks[0] != "index:a:tf:a=1" || ks[1] != "index:a:tf:b=2" {
+		t.Fatalf("snapshot: %v", ks)
+	}
+
+	val, err := kv.Get([]byte("index:a:tf:a"))
+	if err != nil || val != nil {
+		t.Fatalf("deleted key: %q %v", val, err)
+	}
+
+	iter := kv.NewIterator([]byte("index:"))
+	if !iter.Seek([]byte("index:a:tf:bz")) || string(iter.Key()) != "index:a:tf:c" {
+		t.Fatalf("seek: %s", iter.Key())
+	}
+	if !iter.Next() || string(iter.Key()) != "index:b:tf:a" || iter.Next() {
+		t.Fatalf("next after seek: %s", iter.Key())
+	}
+	iter.Release()
+}
+
+func TestMemKV(t *testing.T) {
+	testKV(t, NewMemKV())
+}
+
+func TestMemKVOrder(t *testing.T) {
+	kv := NewMemKV()
+	want := make(map[string]string)
+	var snaps []Snapshot
+	var snapKeys [][]string
+
+	sorted := func(prefix string) []string {
+		var ks []string
+		for k := range want {
+			if strings.HasPrefix(k, prefix) {
+				ks = append(ks, k)
+			}
+		}
+		sort.Strings(ks)
+		for n, k := range ks {
+			ks[n] = k + "=" + want[k]
+		}
+		return ks
+	}
+	keys := func(r KVReader, prefix string) []string {
+		var ks []string
+		iter := r.NewIterator([]byte(prefix))
+		for iter.Next() {
+			ks = append(ks, string(iter.Key())+"="+string(iter.Value()))
+		}
+		iter.Release()
+		return ks
+	}
+
+	for round := 0; round < 20; round++ {
+		batch := kv.NewBatch()
+		for n := 0; n < 100; n++ {
+			k := fmt.Sprintf("index:%d:tf:%d", (round*37+n*11)%7, (round*101+n*13)%257)
+			if n%4 == 3 {
+				batch.Delete([]byte(k))
+				delete(want, k)
+				continue
+			}
+			v := strconv.Itoa(round*100 + n)
+			batch.Put([]byte(k), []byte(v))
+			want[k] = v
+		}
+		if err := kv.Write(batch); err != nil {
+			log.Fatal(err)
+		}
+
+		snap, err := kv.Snapshot()
+		if err != nil {
+			log.Fatal(err)
+		}
+		snaps = append(snaps, snap)
+		snapKeys = append(snapKeys, sorted(""))
+	}
+
+	for _, prefix := range []string{"", "index:3:", "index:3:tf:1", "index:9:"} {
+		if got, ks := keys(kv, prefix), sorted(prefix); !reflect.DeepEqual(got, ks) {
+			t.Fatalf("%q: %v, want %v", prefix, got, ks)
+		}
+	}
+	for k, snap := range snaps {
+		if got := keys(snap, ""); !reflect.DeepEqual(got, snapKeys[k]) {
+			t.Fatalf("snapshot %d: %d keys, want %d", k, len(got), len(snapKeys[k]))
+		}
+		snap.Release()
+	}
+}
+
+func TestLevelKV(t *testing.T) {
+	kv, err := NewLevelKV(t.TempDir(), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer kv.Close()
+
+	testKV(t, kv)
+}
+
+func TestFulltextMemKV(t *testing.T) {
+	index := "mem"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.AddDocs(index, map[string]string{"document_0": "a b c", "document_1": "a d", "document_2": "d"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = fulltext.DelDocs(index, "document_2")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("a d"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 2 || hits.Docs[0].ID != "document_1" {
+		t.Fatalf("hits: %+v", hits.Docs)
+	}
+}
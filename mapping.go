@@ -0,0 +1,196 @@
+package fulltext
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type FieldType uint8
+
+const (
+	// FieldText values are run through the analyzer of the field.
+	FieldText FieldType = iota
+	// FieldKeyword values are indexed as a single token, as is.
+	FieldKeyword
+)
+
+type FieldMapping struct {
+	Type  FieldType
+	Boost float32
+	// Store keeps the original values so they can be retrieved.
+	Store bool
+	// Analyzer names the registered analyzer of a text field, "" for the one
+	// of the index.
+	Analyzer string
+}
+
+// Mapping describes the fields of the documents in an index. Fields added
+// without a mapping are indexed as text with boost 1.
+type Mapping struct {
+	// Source keeps every field of the original documents.
+	Source bool
+	// Analyzer names the registered analyzer of the text fields that name
+	// none, "" for the default analyzer of the Fulltext.
+	Analyzer string
+	Fields   map[string]FieldMapping
+}
+
+// Document is a record with named fields. Texts added to AddDocs live in the
+// unnamed field "".
+type Document struct {
+	ID     string
+	Fields map[string][]string
+}
+
+func NewDocument(id string) *Document {
+	return &Document{ID: id, Fields: make(map[string][]string)}
+}
+
+func (doc *Document) Add(field string, values ...string) *Document {
+	doc.Fields[field] = append(doc.Fields[field], values...)
+	return doc
+}
+
+func (m FieldMapping) boost() float32 {
+	if m.Boost <= 0 {
+		return 1
+	}
+	return m.Boost
+}
+
+func (m *Mapping) field(name string) FieldMapping {
+	if m == nil {
+		return FieldMapping{}
+	}
+	return m.Fields[name]
+}
+
+func (m *Mapping) has(name string) bool {
+	if m == nil {
+		return false
+	}
+	_, exist := m.Fields[name]
+	return exist
+}
+
+// stored returns the fields of doc kept as its source, nil if none is.
+func (m *Mapping) stored(doc *Document) map[string][]string {
+	if m == nil {
+		return nil
+	}
+
+	var fields map[string][]string
+	for name, values := range doc.Fields {
+		if !m.Source && !m.Fields[name].Store {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string][]string)
+		}
+		fields[name] = values
+	}
+	return fields
+}
+
+// textFields are the fields searched by Match, Must, Should and MustNot when
+// the query names none.
+func (m *Mapping) textFields() []string {
+	fields := []string{""}
+	if m == nil {
+		return fields
+	}
+	for name, f := range m.Fields {
+		if f.Type == FieldText && name != "" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+func checkField(name string) error {
+	if strings.ContainsAny(name, ":@") {
+		return fmt.Errorf("fulltext/mapping: invalid field name %q", name)
+	}
+	return nil
+}
+
+// fieldKind is the key kind of a per-field entry. The unnamed field keeps the
+// plain kind, so indexes written before fields existed are read as is.
+func fieldKind(kind, field string) string {
+	if field == "" {
+		return kind
+	}
+	return kind + "@" + field
+}
+
+// PutMapping stores the mapping of index. Fields already mapped keep their
+// type and analyzer, the analyzer of the index can only be set once. The
+// analyzers named must be registered.
+func (fulltext *Fulltext) PutMapping(index string, mapping Mapping) error {
+	if index == "" {
+		return errors.New("fulltext/mapping: index is empty")
+	}
+
+	unlock := fulltext.lock(index)
+	defer unlock()
+
+	current, err := reader{fulltext.db}.mapping(index)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		current = &Mapping{}
+	}
+	if current.Fields == nil {
+		current.Fields = make(map[string]FieldMapping)
+	}
+
+	for name, f := range mapping.Fields {
+		if err := checkField(name); err != nil {
+			return err
+		}
+		if old, exist := current.Fields[name]; exist && old.Type != f.Type {
+			return fmt.Errorf("fulltext/mapping: field %q type can not be changed", name)
+		}
+		if old, exist := current.Fields[name]; exist && old.Analyzer != f.Analyzer {
+			return fmt.Errorf("fulltext/mapping: field %q analyzer can not be changed", name)
+		}
+		if err := fulltext.checkAnalyzer(f.Analyzer); err != nil {
+			return err
+		}
+		current.Fields[name] = f
+	}
+	if mapping.Analyzer != "" && mapping.Analyzer != current.Analyzer {
+		if current.Analyzer != "" {
+			return errors.New("fulltext/mapping: index analyzer can not be changed")
+		}
+		if err := fulltext.checkAnalyzer(mapping.Analyzer); err != nil {
+			return err
+		}
+		current.Analyzer = mapping.Analyzer
+	}
+	current.Source = mapping.Source
+
+	batch := fulltext.db.NewBatch()
+	if err := putMapping(batch, index, current); err != nil {
+		return err
+	}
+
+	return fulltext.db.Write(batch)
+}
+
+func (fulltext *Fulltext) checkAnalyzer(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, exist := fulltext.analyzers.Load(name); !exist {
+		return fmt.Errorf("fulltext/mapping: unknown analyzer %q", name)
+	}
+	return nil
+}
+
+// Mapping returns the stored mapping of index, nil if it has none.
+func (fulltext *Fulltext) Mapping(index string) (*Mapping, error) {
+	return reader{fulltext.db}.mapping(index)
+}
@@ -0,0 +1,96 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestFulltextFields(t *testing.T) {
+	index := "fields"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.PutMapping(index, Mapping{Fields: map[string]FieldMapping{
+		"title": {Type: FieldText, Boost: 3},
+		"body":  {Type: FieldText},
+		"tags":  {Type: FieldKeyword},
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = fulltext.AddDocuments(index,
+		NewDocument("document_0").Add("title", "okapi bm25").Add("body", "a ranking function").Add("tags", "ir", "ranking"),
+		NewDocument("document_1").Add("title", "tf idf").Add("body", "bm25 is better than tf idf").Add("tags", "ir"),
+		NewDocument("document_2").Add("title", "lucene").Add("body", "lucene scores with bm25").Add("tags", "search engine"),
+		NewDocument("document_3").Add("title", "draft").Add("author", "robertson"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	search := func(query *Query) []string {
+		hits, err := fulltext.Search(query.Index(index))
+		if err != nil {
+			log.Fatal(err)
+		}
+		ids := make([]string, 0, len(hits.Docs))
+		for _, doc := range hits.Docs {
+			ids = append(ids, doc.ID)
+		}
+		return ids
+	}
+
+	if ids := search(new(Query).Match("bm25")); len(ids) != 3 || ids[0] != "document_0" {
+		t.Fatalf("title boost: %v", ids)
+	}
+	if ids := search(new(Query).Match("bm25").Fields("title")); len(ids) != 1 || ids[0] != "document_0" {
+		t.Fatalf("title only: %v", ids)
+	}
+	if ids := search(new(Query).Match("bm25").Term("tags", "ir")); len(ids) != 2 {
+		t.Fatalf("keyword filter: %v", ids)
+	}
+	if ids := search(new(Query).Term("tags", "search engine")); len(ids) != 1 || ids[0] != "document_2" {
+		t.Fatalf("keyword value: %v", ids)
+	}
+	if ids := search(new(Query).Match("robertson")); len(ids) != 1 || ids[0] != "document_3" {
+		t.Fatalf("dynamic field: %v", ids)
+	}
+
+	mapping, err := fulltext.Mapping(index)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if f, exist := mapping.Fields["author"]; !exist || f.Type != FieldText {
+		t.Fatalf("mapping: %+v", mapping)
+	}
+
+	err = fulltext.AddDocuments(index, NewDocument("document_0").Add("title", "okapi"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ids := search(new(Query).Term("tags", "ranking")); len(ids) != 0 {
+		t.Fatalf("replaced field: %v", ids)
+	}
+
+	err = fulltext.DelDocs(index, "document_0", "document_1", "document_2", "document_3")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the mapping and the layout bookkeeping outlive the documents
+	kept := map[string]struct{}{mappingKey: {}, seqKey: {}, verKey: {}}
+	iter := fulltext.db.NewIterator([]byte("index:" + index + ":"))
+	for iter.Next() {
+		if _, exist := kept[strings.TrimPrefix(string(iter.Key()), "index:"+index+":")]; !exist {
+			t.Fatalf("left after delete: %s", iter.Key())
+		}
+	}
+	iter.Release()
+}
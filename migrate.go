@@ -0,0 +1,221 @@
+package fulltext
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// migrateBatch bounds the writes of one batch during a migration.
+const migrateBatch = 20000
+
+// Migrate converts an index written in an older layout. Indexes from before
+// the blocks get their documents numbered and the gob encoded tf and pos
+// entries of a token are rewritten as its blocks, then the norms are keyed by
+// number. The work is committed in chunks and an interrupted migration
+// resumes where it stopped. Migrating an index in the current layout does
+// nothing.
+func (fulltext *Fulltext) Migrate(index string) error {
+	unlock := fulltext.lock(index)
+	defer unlock()
+
+	r := reader{fulltext.db}
+
+	ver, err := r.version(index)
+	if err != nil || ver == layoutVersion {
+		return err
+	}
+
+	if ver < 1 {
+		seq, err := fulltext.migrateNums(r, index)
+		if err != nil {
+			return err
+		}
+
+		if err = fulltext.migratePostings(r, index); err != nil {
+			return err
+		}
+
+		batch := fulltext.db.NewBatch()
+		batch.Put([]byte(fmt.Sprintf("%s:%s:%s", indexKey, index, seqKey)), uint32ToByte(seq))
+		batch.Put([]byte(fmt.Sprintf("%s:%s:%s", indexKey, index, verKey)), uint32ToByte(1))
+		if err = fulltext.db.Write(batch); err != nil {
+			return err
+		}
+	}
+
+	if err = fulltext.migrateNorms(r, index); err != nil {
+		return err
+	}
+
+	// the version goes last, an index without it is migrated again
+	batch := fulltext.db.NewBatch()
+	batch.Put([]byte(fmt.Sprintf("%s:%s:%s", indexKey, index, verKey)), uint32ToByte(layoutVersion))
+	return fulltext.db.Write(batch)
+}
+
+// migrateNums numbers the documents in id order, keeping the numbers a
+// previous run handed out, and returns the next free number.
+func (fulltext *Fulltext) migrateNums(r reader, i string) (uint32, error) {
+	prefix := []byte(fmt.Sprintf("%s:%s:%s:", indexKey, i, docKey))
+
+	var ids []string
+	var seq uint32
+	iter := r.NewIterator(prefix)
+	for iter.Next() {
+		id := string(iter.Key()[len(prefix):])
+		num, ok, err := r.docNum(i, id)
+		if err != nil {
+			iter.Release()
+			return 0, err
+		}
+		if !ok {
+			ids = append(ids, id)
+		} else if num >= seq {
+			seq = num + 1
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	batch := fulltext.db.NewBatch()
+	for _, id := range ids {
+		batch.Put(numK(i, id), uint32ToByte(seq))
+		batch.Put(ridK(i, seq), []byte(id))
+		seq++
+
+		if batch.Len() >= migrateBatch {
+			if err := fulltext.db.Write(batch); err != nil {
+				return 0, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := fulltext.db.Write(batch); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// migratePostings replaces the tf and pos entries of every token with its
+// blocks, in the same batch so a token is never converted twice.
+func (fulltext *Fulltext) migratePostings(r reader, i string) error {
+	prefix := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, tfKey))
+
+	snap, err := fulltext.db.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	batch := fulltext.db.NewBatch()
+	iter := snap.NewIterator(prefix)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		kind, token, ok := strings.Cut(string(key[len(prefix)-len(tfKey):]), ":")
+		if !ok || (kind != tfKey && !strings.HasPrefix(kind, tfKey+"@")) {
+			continue
+		}
+		field := strings.TrimPrefix(strings.TrimPrefix(kind, tfKey), "@")
+
+		tf := make(map[string]uint32)
+		if err := byteToAny(iter.Value(), &tf); err != nil {
+			return err
+		}
+
+		posK := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, fieldKind(posKey, field), token))
+		pos := make(map[string][]uint32)
+		val, err := r.Get(posK)
+		if err != nil {
+			return err
+		}
+		if len(val) != 0 {
+			if err := byteToAny(val, &pos); err != nil {
+				return err
+			}
+		}
+
+		ps := make([]posting, 0, len(tf))
+		for id, tfVal := range tf {
+			num, ok, err := r.docNum(i, id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			ps = append(ps, posting{doc: num, tf: tfVal, pos: pos[id]})
+		}
+		sort.Slice(ps, func(a, b int) bool { return ps[a].doc < ps[b].doc })
+
+		pstPrefix := postingsPrefix(i, field, token)
+		for len(ps) != 0 {
+			n := blockSize
+			if len(ps) < n {
+				n = len(ps)
+			}
+			batch.Put(blockKey(pstPrefix, ps[0].doc), encodeBlock(ps[:n]))
+			ps = ps[n:]
+		}
+		batch.Delete(bytes.Clone(key))
+		batch.Delete(posK)
+
+		if batch.Len() >= migrateBatch {
+			if err := fulltext.db.Write(batch); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return fulltext.db.Write(batch)
+}
+
+// migrateNorms writes the norms of every document by number, from the
+// lengths in its id entry, and drops the ones keyed by id.
+func (fulltext *Fulltext) migrateNorms(r reader, i string) error {
+	prefix := []byte(fmt.Sprintf("%s:%s:%s:", indexKey, i, docKey))
+
+	batch := fulltext.db.NewBatch()
+	iter := r.NewIterator(prefix)
+	defer iter.Release()
+	for iter.Next() {
+		id := string(iter.Key()[len(prefix):])
+		num, ok, err := r.docNum(i, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		ts := idTS{}
+		if err := byteToAny(iter.Value(), &ts); err != nil {
+			return err
+		}
+		for field, fts := range ts.fields() {
+			batch.Put(normK(i, field, num), uint32ToByte(fts.S))
+			batch.Delete([]byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, fieldKind(oldNormKey, field), id)))
+		}
+
+		if batch.Len() >= migrateBatch {
+			if err := fulltext.db.Write(batch); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return fulltext.db.Write(batch)
+}
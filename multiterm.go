@@ -0,0 +1,251 @@
+package fulltext
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxExpansions is the number of terms a Prefix, Wildcard or Regexp
+// clause expands to at most, unless the query sets another.
+const DefaultMaxExpansions = 50
+
+// ExpansionScoring is how the terms a Prefix, Wildcard or Regexp clause
+// expands to are scored.
+type ExpansionScoring uint8
+
+const (
+	// ConstantScore scores every document matching the clause 1.
+	ConstantScore ExpansionScoring = iota
+	// BlendedScore scores the terms like the terms of the query, all with
+	// the document frequency of the most frequent one, so a rare expansion,
+	// often a typo, does not outrank the common ones.
+	BlendedScore
+)
+
+type multiTermKind uint8
+
+const (
+	prefixTerm multiTermKind = iota
+	wildcardTerm
+	regexpTerm
+)
+
+// multiTerm is a clause matching every term of a pattern.
+type multiTerm struct {
+	kind    multiTermKind
+	pattern string
+}
+
+// Prefix requires a term starting with prefix. Like Wildcard and Regexp, the
+// pattern is compared with the indexed terms as is, without analysis.
+func (query *Query) Prefix(prefix string) *Query {
+	query.multiTerms = append(query.multiTerms, multiTerm{prefixTerm, prefix})
+	return query
+}
+
+// Wildcard requires a term matching pattern, where * stands for any
+// characters and ? for one.
+func (query *Query) Wildcard(pattern string) *Query {
+	query.multiTerms = append(query.multiTerms, multiTerm{wildcardTerm, pattern})
+	return query
+}
+
+// Regexp requires a term matched as a whole by the regular expression expr,
+// in the syntax of the regexp package.
+func (query *Query) Regexp(expr string) *Query {
+	query.multiTerms = append(query.multiTerms, multiTerm{regexpTerm, expr})
+	return query
+}
+
+// Expansions sets how many of the most frequent terms a Prefix, Wildcard or
+// Regexp clause expands to at most, DefaultMaxExpansions with 0, and how
+// they are scored.
+func (query *Query) Expansions(max int, scoring ExpansionScoring) *Query {
+	query.maxExpansions = max
+	query.expansionScoring = scoring
+	return query
+}
+
+// matcher returns the prefix every matching term starts with and the
+// function telling whether a term matches, nil when any term with the prefix
+// does.
+func (m multiTerm) matcher() (string, func(string) bool, error) {
+	var expr string
+	switch m.kind {
+	case prefixTerm:
+		return m.pattern, nil, nil
+	case wildcardTerm:
+		expr = wildcardExpr(m.pattern)
+	case regexpTerm:
+		expr = m.pattern
+	}
+
+	re, err := regexp.Compile("^(?s:" + expr + ")$")
+	if err != nil {
+		return "", nil, fmt.Errorf("fulltext/search: %w", err)
+	}
+	prefix, _ := re.LiteralPrefix()
+	return prefix, re.MatchString, nil
+}
+
+// analyzed returns m with its literal parts analysed by analyzer, so that a
+// pattern typed in a search box is compared with the terms as they are
+// indexed.
+func (m multiTerm) analyzed(analyzer *Analyzer) multiTerm {
+	expr := m.pattern
+	switch m.kind {
+	case prefixTerm:
+		return multiTerm{prefixTerm, analyzer.literal(m.pattern)}
+	case wildcardTerm:
+		expr = wildcardExpr(m.pattern)
+	}
+
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		// the matcher reports it
+		return m
+	}
+	var walk func(re *syntax.Regexp)
+	walk = func(re *syntax.Regexp) {
+		if re.Op == syntax.OpLiteral {
+			re.Rune = []rune(analyzer.literal(string(re.Rune)))
+		}
+		for _, sub := range re.Sub {
+			walk(sub)
+		}
+	}
+	walk(re)
+	return multiTerm{regexpTerm, re.String()}
+}
+
+// wildcardExpr is the regular expression of a wildcard pattern.
+func wildcardExpr(pattern string) string {
+	var b strings.Builder
+	for _, c := range pattern {
+		b.WriteString(wildcardRune(c, false))
+	}
+	return b.String()
+}
+
+// wildcardRune is the regular expression of a character of a wildcard
+// pattern, matching itself when escaped.
+func wildcardRune(c rune, escaped bool) string {
+	switch {
+	case escaped:
+	case c == '*':
+		return ".*"
+	case c == '?':
+		return "."
+	}
+	return regexp.QuoteMeta(string(c))
+}
+
+// terms calls fn with the terms of field starting with prefix and their
+// document frequency, in order, until fn returns false.
+func (r reader) terms(i, field, prefix string, fn func(term string, df uint32) bool) error {
+	key := []byte(fmt.Sprintf("%s:%s:%s:", indexKey, i, fieldKind(idfKey, field)))
+	l := len(key)
+	iter := r.NewIterator(append(key, prefix...))
+	for iter.Next() {
+		if !fn(string(iter.Key()[l:]), byteToUint32(iter.Value())) {
+			break
+		}
+	}
+	iter.Release()
+
+	return iter.Error()
+}
+
+// expand returns the terms of fields m matches, the max most frequent ones
+// when there are more.
+func expand(r reader, i string, fields []string, m multiTerm, max int) ([]string, error) {
+	prefix, match, err := m.matcher()
+	if err != nil {
+		return nil, err
+	}
+	if max <= 0 {
+		max = DefaultMaxExpansions
+	}
+
+	dfs := make(map[string]uint32)
+	for _, field := range fields {
+		err := r.terms(i, field, prefix, func(term string, df uint32) bool {
+			if match == nil || match(term) {
+				if df > dfs[term] {
+					dfs[term] = df
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	terms := make([]string, 0, len(dfs))
+	for term := range dfs {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(a, b int) bool {
+		if dfs[terms[a]] != dfs[terms[b]] {
+			return dfs[terms[a]] > dfs[terms[b]]
+		}
+		return terms[a] < terms[b]
+	})
+	if len(terms) > max {
+		terms = terms[:max]
+	}
+
+	return terms, nil
+}
+
+// multiTermTF loads the postings of the terms m expands to. With
+// ConstantScore they are merged into a single constant posting list.
+func multiTermTF(r reader, i string, fields []string, m multiTerm, max int, scoring ExpansionScoring) ([]tokenTFIDF, error) {
+	terms, err := expand(r, i, fields, m, max)
+	if err != nil {
+		return nil, err
+	}
+
+	var tfidfs []tokenTFIDF
+	var maxIDF uint32
+	for _, term := range terms {
+		tfidf, err := termTF(r, i, fields, term)
+		if err != nil {
+			return nil, err
+		}
+		if tfidf == nil {
+			continue
+		}
+		if tfidf.tokenIDF > maxIDF {
+			maxIDF = tfidf.tokenIDF
+		}
+		tfidfs = append(tfidfs, *tfidf)
+	}
+	if len(tfidfs) == 0 {
+		return nil, nil
+	}
+
+	switch scoring {
+	case ConstantScore:
+		constant := tokenTFIDF{term: m.pattern, tokenTF: make(map[uint32]uint32), boost: 1, constant: true}
+		for _, tfidf := range tfidfs {
+			for num, tf := range tfidf.tokenTF {
+				constant.tokenTF[num] += tf
+			}
+		}
+		constant.tokenIDF = uint32(len(constant.tokenTF))
+		return []tokenTFIDF{constant}, nil
+	case BlendedScore:
+		for k := range tfidfs {
+			tfidfs[k].tokenIDF = maxIDF
+		}
+		return tfidfs, nil
+	}
+
+	return nil, errors.New("fulltext/search: unknown expansion scoring")
+}
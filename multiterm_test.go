@@ -0,0 +1,79 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFulltextMultiTerm(t *testing.T) {
+	index := "multiterm"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	docs := map[string]string{
+		"document_0": "information retrieval",
+		"document_1": "retrieval systems and retrieval models",
+		"document_2": "retrieve documents",
+		"document_3": "a retriever dog",
+		"document_4": "information theory",
+	}
+	if err = fulltext.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+
+	search := func(query *Query) *Hits {
+		hits, err := fulltext.Search(query.Index(index))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return hits
+	}
+	ids := func(hits *Hits) []string {
+		var ids []string
+		for _, doc := range hits.Docs {
+			ids = append(ids, doc.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	hits := search(new(Query).Prefix("retriev"))
+	if !reflect.DeepEqual(ids(hits), []string{"document_0", "document_1", "document_2", "document_3"}) {
+		t.Fatalf("prefix: %+v", hits.Docs)
+	}
+	for _, doc := range hits.Docs {
+		if doc.Score != 1 {
+			t.Fatalf("constant score: %+v", hits.Docs)
+		}
+	}
+
+	// retrieval is the most frequent expansion
+	hits = search(new(Query).Prefix("retriev").Expansions(1, BlendedScore))
+	if !reflect.DeepEqual(ids(hits), []string{"document_0", "document_1"}) {
+		t.Fatalf("blended: %+v", hits.Docs)
+	}
+
+	if got := ids(search(new(Query).Wildcard("retriev?r"))); !reflect.DeepEqual(got, []string{"document_3"}) {
+		t.Fatalf("wildcard: %v", got)
+	}
+	hits = search(new(Query).Wildcard("*tion").Match("theory"))
+	if !reflect.DeepEqual(ids(hits), []string{"document_0", "document_4"}) || hits.Docs[0].ID != "document_4" {
+		t.Fatalf("wildcard and match: %+v", hits.Docs)
+	}
+	if got := ids(search(new(Query).Regexp("retrie(ve|ver)"))); !reflect.DeepEqual(got, []string{"document_2", "document_3"}) {
+		t.Fatalf("regexp: %v", got)
+	}
+	if got := ids(search(new(Query).Prefix("nothing"))); len(got) != 0 {
+		t.Fatalf("no expansion: %v", got)
+	}
+
+	if _, err = fulltext.Search(new(Query).Index(index).Regexp("retrie(")); err == nil {
+		t.Fatal("invalid regexp")
+	}
+}
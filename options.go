@@ -0,0 +1,120 @@
+package fulltext
+
+import (
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Option configures New and NewWithKV.
+type Option func(*options)
+
+type options struct {
+	leveldb opt.Options
+	// stopWordSource tells a stop word option was given, New reads
+	// stop_word.txt otherwise
+	stopWordSource bool
+	stopWords      []string
+	stopWordFile   string
+	pageSize       int
+	similarity     Similarity
+	analyzer       *Analyzer
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		leveldb: opt.Options{
+			Filter: filter.NewBloomFilter(10),
+		},
+		pageSize:   10,
+		similarity: NewBM25(),
+	}
+	for _, apply := range opts {
+		apply(o)
+	}
+	return o
+}
+
+// WithCacheSize sets the capacity of the goleveldb block cache in bytes.
+func WithCacheSize(size int) Option {
+	return func(o *options) {
+		o.leveldb.BlockCacheCapacity = size
+	}
+}
+
+// WithWriteBuffer sets the size of the goleveldb memtable in bytes.
+func WithWriteBuffer(size int) Option {
+	return func(o *options) {
+		o.leveldb.WriteBuffer = size
+	}
+}
+
+// WithCompression turns the snappy compression of the goleveldb blocks on or
+// off. It is on by default.
+func WithCompression(enabled bool) Option {
+	return func(o *options) {
+		if enabled {
+			o.leveldb.Compression = opt.SnappyCompression
+		} else {
+			o.leveldb.Compression = opt.NoCompression
+		}
+	}
+}
+
+// WithBloomFilter sets the bits per key of the goleveldb bloom filter, 10 by
+// default. 0 disables the filter.
+func WithBloomFilter(bitsPerKey int) Option {
+	return func(o *options) {
+		if bitsPerKey <= 0 {
+			o.leveldb.Filter = nil
+			return
+		}
+		o.leveldb.Filter = filter.NewBloomFilter(bitsPerKey)
+	}
+}
+
+// WithStopWords sets the stop words.
+func WithStopWords(words ...string) Option {
+	return func(o *options) {
+		o.stopWordSource = true
+		o.stopWords = words
+		o.stopWordFile = ""
+	}
+}
+
+// WithStopWordFile reads the stop words from file, one per line.
+func WithStopWordFile(file string) Option {
+	return func(o *options) {
+		o.stopWordSource = true
+		o.stopWords = nil
+		o.stopWordFile = file
+	}
+}
+
+// WithPageSize sets the number of hits returned by the queries that set no
+// size and search an index without a page size of its own, 10 by default.
+func WithPageSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.pageSize = size
+		}
+	}
+}
+
+// WithSimilarity sets the similarity of the indexes without one of their
+// own, BM25 by default.
+func WithSimilarity(similarity Similarity) Option {
+	return func(o *options) {
+		if similarity != nil {
+			o.similarity = similarity
+		}
+	}
+}
+
+// WithAnalyzer sets the analyzer of the fields whose mapping names none. A
+// nil Tokenizer is the tokenizer given to New. The stop word options do not
+// apply to it, the tokenizer with the stop words removed is the default.
+func WithAnalyzer(analyzer *Analyzer) Option {
+	return func(o *options) {
+		o.analyzer = analyzer
+	}
+}
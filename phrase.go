@@ -0,0 +1,226 @@
+package fulltext
+
+import (
+	"sort"
+	"strings"
+)
+
+type phrase struct {
+	text  string
+	terms []string
+	slop  int
+}
+
+// Phrase requires the tokens of str to appear next to each other and in the
+// same order. Every phrase is scored like a term of its own.
+func (query *Query) Phrase(str string) *Query {
+	query.phrases = append(query.phrases, phrase{text: str})
+	return query
+}
+
+// Near requires terms to appear in any order inside a window that has at most
+// slop positions more than the terms themselves.
+func (query *Query) Near(slop int, terms ...string) *Query {
+	if slop < 0 {
+		slop = 0
+	}
+	query.phrases = append(query.phrases, phrase{terms: terms, slop: slop})
+	return query
+}
+
+// PhraseBoost adds the phrase score of the Match text, multiplied by boost,
+// to the documents containing it as an exact phrase.
+func (query *Query) PhraseBoost(boost float32) *Query {
+	query.phraseBoost = boost
+	return query
+}
+
+// phraseTF counts the phrase matches per document in every field, like
+// termTF does for a token. The phrase is analysed for each field group. It
+// returns nil when the phrase has no terms at all, and postings without
+// documents when nothing matches.
+func phraseTF(r reader, i string, groups []fieldGroup, ph phrase) (*tokenTFIDF, error) {
+	var tfidf *tokenTFIDF
+	for _, group := range groups {
+		var terms []string
+		var offsets []uint32
+		if ph.text != "" && ph.slop == 0 {
+			terms, offsets = phraseTerms(group.analyzer, ph.text)
+		} else {
+			// a phrase with slop matches its distinct terms in any order
+			normalized := ph.terms
+			if ph.text != "" {
+				normalized, _ = phraseTerms(group.analyzer, ph.text)
+			}
+			seen := make(map[string]struct{}, len(normalized))
+			for k, term := range normalized {
+				ok := true
+				if ph.text == "" {
+					term, ok = group.analyzer.normalize(ph.terms[k])
+				}
+				if _, exist := seen[term]; ok && !exist {
+					seen[term] = struct{}{}
+					terms = append(terms, term)
+				}
+			}
+		}
+		if len(terms) == 0 {
+			continue
+		}
+
+		if tfidf == nil {
+			tfidf = &tokenTFIDF{term: strings.Join(terms, " "), tokenTF: make(map[uint32]uint32), fieldTF: make(map[string]map[uint32]uint32), boost: 1}
+		}
+		for _, field := range group.fields {
+			tf, err := fieldPhraseTF(r, i, field, terms, offsets, ph.slop)
+			if err != nil {
+				return nil, err
+			}
+			if len(tf) == 0 {
+				continue
+			}
+
+			tfidf.fieldTF[field] = tf
+			for num, freq := range tf {
+				tfidf.tokenTF[num] += freq
+			}
+		}
+	}
+	if tfidf == nil {
+		return nil, nil
+	}
+	tfidf.tokenIDF = uint32(len(tfidf.tokenTF))
+
+	return tfidf, nil
+}
+
+// fieldPhraseTF matches terms at exactly offsets, or within slop when offsets is nil.
+func fieldPhraseTF(r reader, i, field string, terms []string, offsets []uint32, slop int) (map[uint32]uint32, error) {
+	postings := make([]map[uint32][]uint32, len(terms))
+	for k, term := range terms {
+		pos, err := r.pos(i, field, term)
+		if err != nil {
+			return nil, err
+		}
+		if len(pos) == 0 {
+			return nil, nil
+		}
+		postings[k] = pos
+	}
+
+	smallest := postings[0]
+	for _, pos := range postings[1:] {
+		if len(pos) < len(smallest) {
+			smallest = pos
+		}
+	}
+
+	tf := make(map[uint32]uint32)
+	ps := make([][]uint32, len(terms))
+	for num := range smallest {
+		found := true
+		for k, pos := range postings {
+			if ps[k], found = pos[num]; !found {
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		var freq uint32
+		if offsets != nil {
+			freq = exactFreq(ps, offsets)
+		} else {
+			freq = nearFreq(ps, slop)
+		}
+		if freq > 0 {
+			tf[num] = freq
+		}
+	}
+
+	return tf, nil
+}
+
+// phraseTerms analyses str with analyzer and returns its terms with their
+// positions relative to the first one. Only the first token of a position is
+// kept, the others are its synonyms.
+func phraseTerms(analyzer *Analyzer, str string) ([]string, []uint32) {
+	var terms []string
+	var offsets []uint32
+	first, last := -1, -1
+	for _, token := range analyzer.Analyze(str) {
+		if token.Pos == last {
+			continue
+		}
+		last = token.Pos
+		if first < 0 {
+			first = token.Pos
+		}
+		terms = append(terms, token.Term)
+		offsets = append(offsets, uint32(token.Pos-first))
+	}
+
+	return terms, offsets
+}
+
+func exactFreq(ps [][]uint32, offsets []uint32) uint32 {
+	var freq uint32
+	for _, p := range ps[0] {
+		found := true
+		for k := 1; k < len(ps) && found; k++ {
+			want := p + offsets[k]
+			j := sort.Search(len(ps[k]), func(n int) bool { return ps[k][n] >= want })
+			found = j < len(ps[k]) && ps[k][j] == want
+		}
+		if found {
+			freq++
+		}
+	}
+
+	return freq
+}
+
+// nearFreq counts the minimal windows holding every term whose width exceeds
+// the number of terms by at most slop.
+func nearFreq(ps [][]uint32, slop int) uint32 {
+	type occurrence struct {
+		pos  uint32
+		term int
+	}
+
+	var merged []occurrence
+	for k, pos := range ps {
+		for _, p := range pos {
+			merged = append(merged, occurrence{p, k})
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].pos < merged[j].pos })
+
+	var freq uint32
+	counts := make([]int, len(ps))
+	covered, left := 0, 0
+	for _, o := range merged {
+		if counts[o.term] == 0 {
+			covered++
+		}
+		counts[o.term]++
+
+		if covered < len(ps) {
+			continue
+		}
+
+		for counts[merged[left].term] > 1 {
+			counts[merged[left].term]--
+			left++
+		}
+		if int(o.pos-merged[left].pos)+1-len(ps) <= slop {
+			freq++
+		}
+		counts[merged[left].term]--
+		covered--
+		left++
+	}
+
+	return freq
+}
@@ -0,0 +1,318 @@
+package fulltext
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// blockSize bounds the postings per block, so adding or removing a document
+// rewrites one block instead of the whole list.
+const blockSize = 128
+
+var errCorruptBlock = errors.New("fulltext/postings: corrupt block")
+
+// posting is one document of a token's postings list.
+type posting struct {
+	doc uint32
+	tf  uint32
+	pos []uint32
+}
+
+// A token's postings are cut into blocks of consecutive doc numbers. A block
+// is keyed by the token and its base, the smallest doc number it may hold,
+// stored as MaxUint32-base: the first key at or after the one of doc n is
+// then the block n belongs to.
+func postingsPrefix(i, field, token string) []byte {
+	return []byte(fmt.Sprintf("%s:%s:%s:%s\x00", indexKey, i, fieldKind(pstKey, field), token))
+}
+
+func blockKey(prefix []byte, base uint32) []byte {
+	key := make([]byte, len(prefix)+4)
+	copy(key, prefix)
+	binary.BigEndian.PutUint32(key[len(prefix):], math.MaxUint32-base)
+	return key
+}
+
+func blockBase(prefix, key []byte) uint32 {
+	return math.MaxUint32 - binary.BigEndian.Uint32(key[len(prefix):])
+}
+
+// encodeBlock writes the count of postings, then for each the doc number as a
+// delta to the previous one, tf and the positions as deltas.
+func encodeBlock(ps []posting) []byte {
+	buf := make([]byte, 0, len(ps)*4)
+	buf = binary.AppendUvarint(buf, uint64(len(ps)))
+	var prev uint32
+	for _, p := range ps {
+		buf = binary.AppendUvarint(buf, uint64(p.doc-prev))
+		buf = binary.AppendUvarint(buf, uint64(p.tf))
+		buf = binary.AppendUvarint(buf, uint64(len(p.pos)))
+		var prevPos uint32
+		for _, pos := range p.pos {
+			buf = binary.AppendUvarint(buf, uint64(pos-prevPos))
+			prevPos = pos
+		}
+		prev = p.doc
+	}
+	return buf
+}
+
+// decodeBlock reads a block back, skipping the positions unless withPos.
+func decodeBlock(val []byte, withPos bool) ([]posting, error) {
+	next := func() (uint32, error) {
+		v, n := binary.Uvarint(val)
+		if n <= 0 {
+			return 0, errCorruptBlock
+		}
+		val = val[n:]
+		return uint32(v), nil
+	}
+
+	count, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := make([]posting, count)
+	var prev uint32
+	for k := range ps {
+		delta, err := next()
+		if err != nil {
+			return nil, err
+		}
+		tf, err := next()
+		if err != nil {
+			return nil, err
+		}
+		npos, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		var pos []uint32
+		if withPos {
+			pos = make([]uint32, npos)
+		}
+		var prevPos uint32
+		for j := uint32(0); j < npos; j++ {
+			d, err := next()
+			if err != nil {
+				return nil, err
+			}
+			prevPos += d
+			if withPos {
+				pos[j] = prevPos
+			}
+		}
+
+		prev += delta
+		ps[k] = posting{doc: prev, tf: tf, pos: pos}
+	}
+
+	return ps, nil
+}
+
+// postings reads every block of a token, unordered.
+func (r reader) postings(i, field, token string, withPos bool) ([]posting, error) {
+	var ps []posting
+	iter := r.NewIterator(postingsPrefix(i, field, token))
+	for iter.Next() {
+		block, err := decodeBlock(iter.Value(), withPos)
+		if err != nil {
+			iter.Release()
+			return nil, err
+		}
+		ps = append(ps, block...)
+	}
+	iter.Release()
+	err := iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func (r reader) tf(i, field, token string) (map[uint32]uint32, error) {
+	ps, err := r.postings(i, field, token, false)
+	if err != nil || len(ps) == 0 {
+		return nil, err
+	}
+
+	tf := make(map[uint32]uint32, len(ps))
+	for _, p := range ps {
+		tf[p.doc] = p.tf
+	}
+
+	return tf, nil
+}
+
+func (r reader) pos(i, field, token string) (map[uint32][]uint32, error) {
+	ps, err := r.postings(i, field, token, true)
+	if err != nil || len(ps) == 0 {
+		return nil, err
+	}
+
+	pos := make(map[uint32][]uint32, len(ps))
+	for _, p := range ps {
+		pos[p.doc] = p.pos
+	}
+
+	return pos, nil
+}
+
+type block struct {
+	base uint32
+	// origin is the base of the stored key, stored tells whether there is one
+	origin   uint32
+	stored   bool
+	loaded   bool
+	dirty    bool
+	postings []posting
+}
+
+type termBlocks struct {
+	prefix []byte
+	blocks []*block // sorted by base
+}
+
+// postingsWriter collects the changes of a batch to the postings lists,
+// reading only the blocks that change.
+type postingsWriter struct {
+	r     reader
+	i     string
+	terms map[fieldToken]*termBlocks
+}
+
+func newPostingsWriter(r reader, i string) *postingsWriter {
+	return &postingsWriter{r: r, i: i, terms: make(map[fieldToken]*termBlocks)}
+}
+
+// term lists the blocks of a token, without reading them yet.
+func (w *postingsWriter) term(ft fieldToken) (*termBlocks, error) {
+	if tb, exist := w.terms[ft]; exist {
+		return tb, nil
+	}
+
+	tb := &termBlocks{prefix: postingsPrefix(w.i, ft.field, ft.token)}
+	iter := w.r.NewIterator(tb.prefix)
+	for iter.Next() {
+		base := blockBase(tb.prefix, iter.Key())
+		tb.blocks = append(tb.blocks, &block{base: base, origin: base, stored: true})
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	sort.Slice(tb.blocks, func(i, j int) bool { return tb.blocks[i].base < tb.blocks[j].base })
+
+	w.terms[ft] = tb
+	return tb, nil
+}
+
+// block returns the block doc belongs to. A doc below every base moves the
+// first block down to it, and a token without blocks gets its first one.
+func (w *postingsWriter) block(tb *termBlocks, doc uint32, create bool) (*block, error) {
+	k := sort.Search(len(tb.blocks), func(n int) bool { return tb.blocks[n].base > doc }) - 1
+	if k < 0 {
+		if !create {
+			return nil, nil
+		}
+		if len(tb.blocks) == 0 {
+			tb.blocks = append(tb.blocks, &block{base: doc, loaded: true})
+			return tb.blocks[0], nil
+		}
+		k = 0
+		tb.blocks[0].base = doc
+		tb.blocks[0].dirty = true
+	}
+
+	b := tb.blocks[k]
+	if !b.loaded {
+		val, err := w.r.Get(blockKey(tb.prefix, b.origin))
+		if err != nil {
+			return nil, err
+		}
+		b.postings, err = decodeBlock(val, true)
+		if err != nil {
+			return nil, err
+		}
+		b.loaded = true
+	}
+
+	return b, nil
+}
+
+// put adds or replaces the posting of p.doc and reports whether it is new.
+func (w *postingsWriter) put(ft fieldToken, p posting) (bool, error) {
+	tb, err := w.term(ft)
+	if err != nil {
+		return false, err
+	}
+	b, err := w.block(tb, p.doc, true)
+	if err != nil {
+		return false, err
+	}
+
+	b.dirty = true
+	k := sort.Search(len(b.postings), func(n int) bool { return b.postings[n].doc >= p.doc })
+	if k < len(b.postings) && b.postings[k].doc == p.doc {
+		b.postings[k] = p
+		return false, nil
+	}
+
+	b.postings = append(b.postings, posting{})
+	copy(b.postings[k+1:], b.postings[k:])
+	b.postings[k] = p
+	return true, nil
+}
+
+// del removes the posting of doc and reports whether there was one.
+func (w *postingsWriter) del(ft fieldToken, doc uint32) (bool, error) {
+	tb, err := w.term(ft)
+	if err != nil {
+		return false, err
+	}
+	b, err := w.block(tb, doc, false)
+	if err != nil || b == nil {
+		return false, err
+	}
+
+	k := sort.Search(len(b.postings), func(n int) bool { return b.postings[n].doc >= doc })
+	if k == len(b.postings) || b.postings[k].doc != doc {
+		return false, nil
+	}
+
+	b.dirty = true
+	b.postings = append(b.postings[:k], b.postings[k+1:]...)
+	return true, nil
+}
+
+// flush writes the changed blocks to batch, dropping the empty ones. An
+// overfull block is split into as few blocks of even size as fit.
+func (w *postingsWriter) flush(batch Batch) {
+	for _, tb := range w.terms {
+		for _, b := range tb.blocks {
+			if !b.dirty {
+				continue
+			}
+			if b.stored {
+				batch.Delete(blockKey(tb.prefix, b.origin))
+			}
+
+			ps := b.postings
+			base := b.base
+			for n := (len(ps) + blockSize - 1) / blockSize; n > 0; n-- {
+				size := (len(ps) + n - 1) / n
+				batch.Put(blockKey(tb.prefix, base), encodeBlock(ps[:size]))
+				ps = ps[size:]
+				if len(ps) != 0 {
+					base = ps[0].doc
+				}
+			}
+		}
+	}
+}
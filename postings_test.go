@@ -0,0 +1,222 @@
+package fulltext
+
+import (
+	"errors"
+	"fmt"
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestBlock(t *testing.T) {
+	ps := []posting{{3, 2, []uint32{1, 7}}, {4, 1, []uint32{0}}, {130, 3, []uint32{2, 3, 900}}}
+
+	got, err := decodeBlock(encodeBlock(ps), true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, ps) {
+		t.Fatalf("round trip: %v", got)
+	}
+
+	got, err = decodeBlock(encodeBlock(ps), false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(got) != 3 || got[2].doc != 130 || got[2].tf != 3 || got[2].pos != nil {
+		t.Fatalf("without positions: %v", got)
+	}
+
+	if _, err = decodeBlock([]byte{5, 1}, true); !errors.Is(err, errCorruptBlock) {
+		t.Fatalf("corrupt: %v", err)
+	}
+}
+
+func TestFulltextPostings(t *testing.T) {
+	index := "postings"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	// enough documents for several blocks, added in batches out of order
+	for batch := 2; batch >= 0; batch-- {
+		docs := make(map[string]string)
+		for n := batch * 200; n < batch*200+200; n++ {
+			text := "okapi"
+			if n%2 == 0 {
+				text += " bm25"
+			}
+			docs[fmt.Sprintf("document_%03d", n)] = text
+		}
+		if err = fulltext.AddDocs(index, docs); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var del []string
+	for n := 0; n < 600; n += 4 {
+		del = append(del, fmt.Sprintf("document_%03d", n))
+	}
+	if err = fulltext.DelDocs(index, del...); err != nil {
+		log.Fatal(err)
+	}
+
+	r := reader{fulltext.db}
+	ps, err := r.postings(index, "", "bm25", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(ps) != 150 {
+		t.Fatalf("postings: %d", len(ps))
+	}
+
+	blocks := 0
+	iter := fulltext.db.NewIterator(postingsPrefix(index, "", "okapi"))
+	for iter.Next() {
+		blocks++
+	}
+	iter.Release()
+	if blocks < 450/blockSize {
+		t.Fatalf("blocks: %d", blocks)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("bm25").Limit(0, 1000))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 150 || hits.Docs[0].ID != "document_002" {
+		t.Fatalf("hits: %d %+v", hits.Total, hits.Docs[0])
+	}
+}
+
+func TestFulltextMigrate(t *testing.T) {
+	index := "legacy"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	// the gob encoded layout of earlier versions
+	put := func(key string, v any) {
+		val, ok := v.([]byte)
+		if !ok {
+			if val, err = anyToByte(v); err != nil {
+				log.Fatal(err)
+			}
+		}
+		batch := fulltext.db.NewBatch()
+		batch.Put([]byte("index:"+index+":"+key), val)
+		if err = fulltext.db.Write(batch); err != nil {
+			log.Fatal(err)
+		}
+	}
+	put("id:document_0", idTS{T: []string{"okapi", "bm25"}, S: 2})
+	put("id:document_1", idTS{T: []string{"bm25"}, S: 1})
+	put("tf:okapi", map[string]uint32{"document_0": 1})
+	put("tf:bm25", map[string]uint32{"document_0": 1, "document_1": 1})
+	put("pos:okapi", map[string][]uint32{"document_0": {0}})
+	put("pos:bm25", map[string][]uint32{"document_0": {1}, "document_1": {0}})
+	put("idf:okapi", uint32ToByte(1))
+	put("idf:bm25", uint32ToByte(2))
+	put("ts", uint64ToByte(3))
+	put("ds", uint32ToByte(2))
+
+	if _, err = fulltext.Search(new(Query).Index(index).Match("bm25")); !errors.Is(err, ErrOldLayout) {
+		t.Fatalf("old layout: %v", err)
+	}
+
+	for run := 0; run < 2; run++ {
+		if err = fulltext.Migrate(index); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Phrase("okapi bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 1 || hits.Docs[0].ID != "document_0" {
+		t.Fatalf("phrase: %+v", hits.Docs)
+	}
+
+	if err = fulltext.AddDocs(index, map[string]string{"document_2": "bm25"}); err != nil {
+		log.Fatal(err)
+	}
+	hits, err = fulltext.Search(new(Query).Index(index).Match("bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 3 {
+		t.Fatalf("after migration: %+v", hits.Docs)
+	}
+
+	iter := fulltext.db.NewIterator([]byte("index:" + index + ":" + tfKey))
+	for iter.Next() {
+		t.Fatalf("left: %s", iter.Key())
+	}
+	iter.Release()
+}
+
+func TestFulltextDocNums(t *testing.T) {
+	index := "nums"
+
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	r := reader{fulltext.db}
+	num := func(id string) uint32 {
+		n, ok, err := r.docNum(index, id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("%s has no number", id)
+		}
+		return n
+	}
+
+	err = fulltext.AddDocuments(index, NewDocument("a").Add("", "okapi"), NewDocument("b").Add("", "okapi bm25"), NewDocument("c").Add("", "bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	freed := num("b")
+	if err = fulltext.DelDocs(index, "b"); err != nil {
+		log.Fatal(err)
+	}
+	if err = fulltext.AddDocs(index, map[string]string{"d": "bm25 bm25"}); err != nil {
+		log.Fatal(err)
+	}
+	if num("d") != freed {
+		t.Fatalf("number %d not reused: %d", freed, num("d"))
+	}
+	if id, err := r.docID(index, freed); err != nil || id != "d" {
+		t.Fatalf("reverse mapping: %q %v", id, err)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("bm25"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 2 || hits.Docs[0].ID != "d" || hits.Docs[1].ID != "c" {
+		t.Fatalf("hits: %+v", hits.Docs)
+	}
+
+	if err = fulltext.DelDocs(index, "a", "c", "d"); err != nil {
+		log.Fatal(err)
+	}
+	if err = fulltext.AddDocs(index, map[string]string{"e": "okapi"}); err != nil {
+		log.Fatal(err)
+	}
+	if num("e") != 0 {
+		t.Fatalf("emptied index numbers from %d", num("e"))
+	}
+}
@@ -0,0 +1,399 @@
+package fulltext
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseError is a syntax error of a query string, at the byte offset Pos.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("fulltext/query: %s at %d", err.Msg, err.Pos)
+}
+
+// defaultSlop is the slop of a phrase followed by ~ without a number.
+const defaultSlop = 2
+
+type occurrence uint8
+
+const (
+	shouldOccur occurrence = iota
+	mustOccur
+	mustNotOccur
+)
+
+// ParseQuery parses the query string of a search box into a query tree:
+//
+//	title:bm25 "okapi system"~2 -draft +(ranking OR scoring) tag:ir~ idf^2 rank*
+//
+// Words and quoted phrases are analysed at search time by the analyzer of
+// the searched fields, so a word segmented into several tokens requires all
+// of them. A field name and a colon restrict a word, a phrase or a group to
+// that field. The words are optional unless prefixed by + or AND, while -
+// and NOT exclude them; OR and AND bind tighter than the words next to each
+// other, AND tighter than OR, and a clause excluded by - or NOT cannot be
+// an operand of OR. A word with * or ? is a wildcard, its letters and
+// digits analysed like words, a word with ~ is fuzzy, with automatic edits
+// or the number after it, and ~ after a phrase is its slop, the number
+// after it or 2. ^ boosts what it follows. A backslash escapes the
+// character after it, a wildcard included.
+func ParseQuery(str string) (*Query, error) {
+	p := &parser{str: str}
+	clause, err := p.seq(nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(str) {
+		return nil, p.errorf(p.pos, "unexpected %q", p.peek())
+	}
+
+	query := new(Query)
+	if clause != nil {
+		query.Clause(clause)
+	}
+	return query, nil
+}
+
+type parser struct {
+	str string
+	pos int
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &ParseError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// peek returns the next character, 0 at the end.
+func (p *parser) peek() rune {
+	if p.pos >= len(p.str) {
+		return 0
+	}
+	c, _ := utf8.DecodeRuneInString(p.str[p.pos:])
+	return c
+}
+
+// advance moves past the next character.
+func (p *parser) advance() {
+	_, size := utf8.DecodeRuneInString(p.str[p.pos:])
+	p.pos += size
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.str) {
+		c, size := utf8.DecodeRuneInString(p.str[p.pos:])
+		if !unicode.IsSpace(c) {
+			return
+		}
+		p.pos += size
+	}
+}
+
+// keyword consumes the operator word if it comes next.
+func (p *parser) keyword(word string) bool {
+	p.skipSpace()
+	if !strings.HasPrefix(p.str[p.pos:], word) {
+		return false
+	}
+	end := p.pos + len(word)
+	if end < len(p.str) {
+		c, _ := utf8.DecodeRuneInString(p.str[end:])
+		if !unicode.IsSpace(c) && c != '(' && c != '"' {
+			return false
+		}
+	}
+	p.pos = end
+	return true
+}
+
+// seq parses clauses next to each other, up to the end or the parenthesis
+// closing a group.
+func (p *parser) seq(fields []string, group bool) (Clause, error) {
+	b := &BoolClause{}
+	for {
+		p.skipSpace()
+		if p.pos == len(p.str) || group && p.peek() == ')' {
+			break
+		}
+
+		clause, occur, err := p.or(fields)
+		if err != nil {
+			return nil, err
+		}
+		switch occur {
+		case mustOccur:
+			b.Must = append(b.Must, clause)
+		case mustNotOccur:
+			b.MustNot = append(b.MustNot, clause)
+		default:
+			b.Should = append(b.Should, clause)
+		}
+	}
+
+	switch {
+	case len(b.Must)+len(b.Should)+len(b.MustNot) == 0:
+		return nil, nil
+	case len(b.Should) == 1 && len(b.Must)+len(b.MustNot) == 0:
+		return b.Should[0], nil
+	case len(b.Must) == 1 && len(b.Should)+len(b.MustNot) == 0:
+		return b.Must[0], nil
+	}
+	return b, nil
+}
+
+func (p *parser) or(fields []string) (Clause, occurrence, error) {
+	p.skipSpace()
+	start := p.pos
+	clause, occur, err := p.and(fields)
+	if err != nil || !p.keyword("OR") {
+		return clause, occur, err
+	}
+
+	b := &BoolClause{}
+	for {
+		// a clause excluding documents matches none on its own
+		if occur == mustNotOccur {
+			return nil, 0, p.errorf(start, "negation in OR")
+		}
+		b.Should = append(b.Should, clause)
+
+		if len(b.Should) > 1 && !p.keyword("OR") {
+			return b, shouldOccur, nil
+		}
+		p.skipSpace()
+		start = p.pos
+		if clause, occur, err = p.and(fields); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+func (p *parser) and(fields []string) (Clause, occurrence, error) {
+	clause, occur, err := p.unary(fields)
+	if err != nil || !p.keyword("AND") {
+		return clause, occur, err
+	}
+
+	b := &BoolClause{}
+	for {
+		if occur == mustNotOccur {
+			b.MustNot = append(b.MustNot, clause)
+		} else {
+			b.Must = append(b.Must, clause)
+		}
+
+		if len(b.Must)+len(b.MustNot) > 1 && !p.keyword("AND") {
+			return b, shouldOccur, nil
+		}
+		if clause, occur, err = p.unary(fields); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+func (p *parser) unary(fields []string) (Clause, occurrence, error) {
+	p.skipSpace()
+	if p.keyword("NOT") {
+		clause, _, err := p.unary(fields)
+		return clause, mustNotOccur, err
+	}
+
+	occur := shouldOccur
+	switch p.peek() {
+	case '+':
+		occur = mustOccur
+		p.pos++
+	case '-':
+		occur = mustNotOccur
+		p.pos++
+	}
+	clause, err := p.primary(fields)
+	return clause, occur, err
+}
+
+// primary parses a word, a phrase or a group, with its field, and the boost
+// following it.
+func (p *parser) primary(fields []string) (Clause, error) {
+	start := p.pos
+	var clause Clause
+
+	switch c := p.peek(); {
+	case c == 0 || unicode.IsSpace(c):
+		return nil, p.errorf(start, "missing term")
+
+	case c == '(':
+		p.pos++
+		group, err := p.seq(fields, true)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf(start, "unclosed parenthesis")
+		}
+		p.pos++
+		if group == nil {
+			return nil, p.errorf(start, "empty group")
+		}
+		clause = group
+
+	case c == '"':
+		p.pos++
+		var b strings.Builder
+		for {
+			c := p.peek()
+			if c == 0 {
+				return nil, p.errorf(start, "unclosed quote")
+			}
+			p.advance()
+			if c == '"' {
+				break
+			}
+			if c == '\\' && p.pos < len(p.str) {
+				c = p.peek()
+				p.advance()
+			}
+			b.WriteRune(c)
+		}
+		ph := &PhraseClause{Text: b.String(), Fields: fields}
+		if p.peek() == '~' {
+			p.pos++
+			ph.Slop = defaultSlop
+			if c := p.peek(); c >= '0' && c <= '9' {
+				slop, err := p.number(false)
+				if err != nil {
+					return nil, err
+				}
+				ph.Slop = int(slop)
+			}
+		}
+		clause = ph
+
+	case isSpecial(c):
+		return nil, p.errorf(start, "unexpected %q", c)
+
+	default:
+		word, expr := p.word()
+		if p.peek() == ':' {
+			p.pos++
+			return p.primary([]string{word})
+		}
+
+		switch {
+		case expr == "":
+			m := &MatchClause{Text: word, Fields: fields, RequireAll: true}
+			if p.peek() == '~' {
+				p.pos++
+				m.Fuzziness = AutoFuzziness
+				if c := p.peek(); c >= '0' && c <= '9' {
+					edits, err := p.number(false)
+					if err != nil {
+						return nil, err
+					}
+					m.Fuzziness = int(edits)
+				}
+			}
+			clause = m
+		case expr != wildcardExpr(word):
+			// escaped wildcards match themselves
+			clause = &RegexpClause{Expr: expr, Fields: fields, analyzed: true}
+		case strings.IndexAny(word, "*?") == len(word)-1 && word[len(word)-1] == '*':
+			clause = &PrefixClause{Prefix: word[:len(word)-1], Fields: fields, analyzed: true}
+		default:
+			clause = &WildcardClause{Pattern: word, Fields: fields, analyzed: true}
+		}
+	}
+
+	if p.peek() == '^' {
+		p.pos++
+		boost, err := p.number(true)
+		if err != nil {
+			return nil, err
+		}
+		setBoost(clause, float32(boost))
+	}
+	return clause, nil
+}
+
+// word reads a word up to a space or a special character. When it has
+// unescaped wildcards, it also returns the regular expression of the word.
+func (p *parser) word() (string, string) {
+	var b, expr strings.Builder
+	wild := false
+	for p.pos < len(p.str) {
+		c := p.peek()
+		if unicode.IsSpace(c) || isSpecial(c) {
+			break
+		}
+		p.advance()
+		escaped := c == '\\' && p.pos < len(p.str)
+		if escaped {
+			c = p.peek()
+			p.advance()
+		} else if c == '*' || c == '?' {
+			wild = true
+		}
+		b.WriteRune(c)
+		expr.WriteString(wildcardRune(c, escaped))
+	}
+	if !wild {
+		return b.String(), ""
+	}
+	return b.String(), expr.String()
+}
+
+// number reads the number of a slop, edits or, with fraction, a boost.
+func (p *parser) number(fraction bool) (float64, error) {
+	start := p.pos
+	for p.pos < len(p.str) {
+		c := p.str[p.pos]
+		if (c < '0' || c > '9') && (!fraction || c != '.') {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, p.errorf(start, "missing number")
+	}
+	n, err := strconv.ParseFloat(p.str[start:p.pos], 64)
+	if err != nil {
+		return 0, p.errorf(start, "bad number %q", p.str[start:p.pos])
+	}
+	return n, nil
+}
+
+func isSpecial(c rune) bool {
+	switch c {
+	case '(', ')', '"', ':', '^', '~':
+		return true
+	}
+	return false
+}
+
+func setBoost(clause Clause, boost float32) {
+	switch c := clause.(type) {
+	case *BoolClause:
+		c.Boost = boost
+	case *MatchClause:
+		c.Boost = boost
+	case *TermClause:
+		c.Boost = boost
+	case *PhraseClause:
+		c.Boost = boost
+	case *PrefixClause:
+		c.Boost = boost
+	case *WildcardClause:
+		c.Boost = boost
+	case *RegexpClause:
+		c.Boost = boost
+	case *FuzzyClause:
+		c.Boost = boost
+	case *RangeClause:
+		c.Boost = boost
+	}
+}
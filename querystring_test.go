@@ -0,0 +1,191 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	query, err := ParseQuery(`title:bm25 "okapi system"~2 -draft +(ranking OR scoring^2) tag:ir~ rank*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &BoolClause{
+		Should: []Clause{
+			&MatchClause{Text: "bm25", Fields: []string{"title"}, RequireAll: true},
+			&PhraseClause{Text: "okapi system", Slop: 2},
+			&MatchClause{Text: "ir", Fields: []string{"tag"}, Fuzziness: AutoFuzziness, RequireAll: true},
+			&PrefixClause{Prefix: "rank", analyzed: true},
+		},
+		Must: []Clause{&BoolClause{Should: []Clause{
+			&MatchClause{Text: "ranking", RequireAll: true},
+			&MatchClause{Text: "scoring", RequireAll: true, Boost: 2},
+		}}},
+		MustNot: []Clause{&MatchClause{Text: "draft", RequireAll: true}},
+	}
+	if !reflect.DeepEqual(query.clauses, []Clause{want}) {
+		t.Fatalf("parsed: %#v", query.clauses[0])
+	}
+
+	query, err = ParseQuery(`a OR b AND NOT c d\:e`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &BoolClause{Should: []Clause{
+		&BoolClause{Should: []Clause{
+			&MatchClause{Text: "a", RequireAll: true},
+			&BoolClause{
+				Must:    []Clause{&MatchClause{Text: "b", RequireAll: true}},
+				MustNot: []Clause{&MatchClause{Text: "c", RequireAll: true}},
+			},
+		}},
+		&MatchClause{Text: "d:e", RequireAll: true},
+	}}
+	if !reflect.DeepEqual(query.clauses, []Clause{want}) {
+		t.Fatalf("operators: %#v", query.clauses[0])
+	}
+
+	for str, want := range map[string]Clause{
+		`"a b"~`:    &PhraseClause{Text: "a b", Slop: defaultSlop},
+		`okapi\*x*`: &RegexpClause{Expr: `okapi\*x.*`, analyzed: true},
+		`ok\?pi?`:   &RegexpClause{Expr: `ok\?pi.`, analyzed: true},
+		`bm\*25`:    &MatchClause{Text: "bm*25", RequireAll: true},
+		`ok*pi?`:    &WildcardClause{Pattern: "ok*pi?", analyzed: true},
+	} {
+		query, err := ParseQuery(str)
+		if err != nil {
+			t.Fatalf("%s: %v", str, err)
+		}
+		if !reflect.DeepEqual(query.clauses, []Clause{want}) {
+			t.Fatalf("%s: %#v", str, query.clauses[0])
+		}
+	}
+
+	for str, pos := range map[string]int{
+		`a "b c`:            2,
+		`(a b`:              0,
+		`a ()`:              2,
+		`title:`:            6,
+		`a^x`:               2,
+		`a OR`:              4,
+		`- a`:               1,
+		`a) b`:              1,
+		`x AND ~y`:          6,
+		`a OR -b`:           5,
+		`NOT a OR b`:        0,
+		`(a OR b) OR NOT c`: 12,
+	} {
+		_, err := ParseQuery(str)
+		if perr, ok := err.(*ParseError); !ok || perr.Pos != pos {
+			t.Fatalf("%s: %v, want position %d", str, err, pos)
+		}
+	}
+}
+
+func TestFulltextParseQuery(t *testing.T) {
+	index := "querystring"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.BigramTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	err = fulltext.PutMapping(index, Mapping{Fields: map[string]FieldMapping{
+		"title": {Type: FieldText},
+		"body":  {Type: FieldText},
+		"tag":   {Type: FieldKeyword},
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = fulltext.AddDocuments(index,
+		NewDocument("document_0").Add("title", "Okapi BM25").Add("body", "the okapi system ranks documents").Add("tag", "ir"),
+		NewDocument("document_1").Add("title", "Draft").Add("body", "bm25 in the okapi retrieval system").Add("tag", "ir"),
+		NewDocument("document_2").Add("title", "信息检索").Add("body", "信息论与检索").Add("tag", "zh"),
+		NewDocument("document_3").Add("title", "信息论").Add("body", "检索信息").Add("tag", "zh"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ids := func(str string) []string {
+		query, err := ParseQuery(str)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hits, err := fulltext.Search(query.Index(index))
+		if err != nil {
+			log.Fatal(err)
+		}
+		var ids []string
+		for _, doc := range hits.Docs {
+			ids = append(ids, doc.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	for str, want := range map[string][]string{
+		`title:bm25 "okapi system" -draft tag:ir~`: {"document_0"},
+		`"okapi system"~3`:                         {"document_0", "document_1"},
+		`+okapi +(retrieval OR ranks)`:             {"document_0", "document_1"},
+		`tag:zh AND NOT body:检索信息`:                 {"document_2"},
+		`title:信息检索`:                               {"document_2"},
+		`retr*`:                                    {"document_1"},
+		`r?nks`:                                    {"document_0"},
+		`Retr*`:                                    {"document_1"},
+		`R?NKS OR *TRIEVAL`:                        {"document_0", "document_1"},
+		`OK\?PI*`:                                  nil,
+		`r\?nks*`:                                  nil,
+		`bm25 NOT title:okapi`:                     {"document_1"},
+	} {
+		if got := ids(str); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: %v, want %v", str, got, want)
+		}
+	}
+}
+
+func TestFulltextParseQueryAnalyzed(t *testing.T) {
+	for _, tokenizer := range []*seg.WordTokenizer{{}, {Stem: true}} {
+		fulltext, err := NewWithKV(NewMemKV(), tokenizer)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = fulltext.AddDocs("analyzed", map[string]string{"document_0": "Okapi retrieval", "document_1": "Lucene ranking"})
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the stems are retriev, rank and lucen
+		for str, counts := range map[string][2]int{
+			`Retrieval`:  {1, 1},
+			`Retriev*`:   {1, 1},
+			`Retrieval*`: {1, 1},
+			`RANK?NG`:    {1, 0},
+			`Luc*n?`:     {1, 0},
+			`LUC*`:       {1, 1},
+			`*`:          {2, 2},
+			`OKAPI\?*`:   {0, 0},
+		} {
+			query, err := ParseQuery(str)
+			if err != nil {
+				log.Fatal(err)
+			}
+			hits, err := fulltext.Search(query.Index("analyzed"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			want := counts[0]
+			if tokenizer.Stem {
+				want = counts[1]
+			}
+			if hits.Total != want {
+				t.Fatalf("stem %v, %s: %+v", tokenizer.Stem, str, hits.Docs)
+			}
+		}
+		fulltext.Free()
+	}
+}
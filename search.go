@@ -1,10 +1,7 @@
 package fulltext
 
 import (
-	"golang.org/x/sync/errgroup"
-	"math"
 	"sort"
-	"sync"
 	"time"
 )
 
@@ -12,21 +9,50 @@ type Hits struct {
 	Total int
 	Took  int
 	Docs  []Doc
+	// Suggestions are corrections of the Match text, see Query.SpellCheck.
+	Suggestions []string
+	index       string
 }
 
 type Doc struct {
-	ID    string
-	Score float32
+	ID         string
+	Score      float32
+	Fields     map[string][]string
+	Highlights map[string][]string
+	// Explanation tells how Score was computed, see Query.Explain.
+	Explanation *Explanation
 }
 
 type Query struct {
-	index   string
-	match   string
-	must    []string
-	should  []string
-	mustNot []string
-	from    int
-	size    int
+	index            string
+	match            string
+	must             []string
+	should           []string
+	mustNot          []string
+	filter           []string
+	boost            float32
+	explain          bool
+	fields           []string
+	terms            []fieldToken
+	phrases          []phrase
+	multiTerms       []multiTerm
+	maxExpansions    int
+	expansionScoring ExpansionScoring
+	fuzzies          []fuzzy
+	clauses          []Clause
+	sorts            []sortField
+	fuzziness        int
+	fuzzyPrefix      int
+	noTranspositions bool
+	spellCheck       bool
+	spellMaxHits     int
+	phraseBoost      float32
+	source           bool
+	sourceFields     []string
+	highlighter      *Highlighter
+	highlightFields  []string
+	from             int
+	size             int
 }
 
 func (query *Query) Index(str string) *Query {
@@ -39,18 +65,72 @@ func (query *Query) Match(str string) *Query {
 	return query
 }
 
+// Must requires every token of str, adding to the ones of previous calls. A
+// token given as token^boost has its score multiplied by boost, as with
+// Should. A token Match already scores is only required, unless it has a
+// boost.
 func (query *Query) Must(str ...string) *Query {
-	query.must = str
+	query.must = append(query.must, str...)
 	return query
 }
 
+// Filter requires every token of str like Must, but does not score them.
+func (query *Query) Filter(str ...string) *Query {
+	query.filter = append(query.filter, str...)
+	return query
+}
+
+// Should scores the documents holding tokens of str higher, adding to the
+// ones of previous calls. Should("bm25^3") weighs bm25 three times as much
+// as the tokens of Match. Without a boost, a token Match already scores is
+// not scored again.
 func (query *Query) Should(str ...string) *Query {
-	query.should = str
+	query.should = append(query.should, str...)
+	return query
+}
+
+// Boost multiplies the scores of the query by boost, to weigh it against the
+// other clauses when it is the clause of another query.
+func (query *Query) Boost(boost float32) *Query {
+	query.boost = boost
 	return query
 }
 
+// MustNot leaves out the documents holding any token of str, adding to the
+// ones of previous calls.
 func (query *Query) MustNot(str ...string) *Query {
-	query.mustNot = str
+	query.mustNot = append(query.mustNot, str...)
+	return query
+}
+
+// Clause requires the documents to match c, a query tree nesting the
+// clauses the builder methods cannot express, like (a OR b) AND NOT (c AND
+// d). The clauses of the tree that name no fields search the fields of the
+// query.
+func (query *Query) Clause(c Clause) *Query {
+	query.clauses = append(query.clauses, c)
+	return query
+}
+
+// Fields sets the fields searched by Match, Must, Should, MustNot, the
+// phrases and the Prefix, Wildcard and Regexp clauses. By default every text
+// field of the index is searched.
+func (query *Query) Fields(names ...string) *Query {
+	query.fields = names
+	return query
+}
+
+// Term requires value to be a token of field, typically a keyword field.
+func (query *Query) Term(field, value string) *Query {
+	query.terms = append(query.terms, fieldToken{field, value})
+	return query
+}
+
+// SpellCheck fills Hits.Suggestions with the corrections of the Match text
+// when the query has maxHits hits or less.
+func (query *Query) SpellCheck(maxHits int) *Query {
+	query.spellCheck = true
+	query.spellMaxHits = maxHits
 	return query
 }
 
@@ -60,22 +140,34 @@ func (query *Query) Limit(from, size int) *Query {
 	return query
 }
 
+// tokenTFIDF holds the postings of a token in the searched fields. tokenTF is
+// summed over the fields and tells which documents contain the token at all.
+// A constant one scores its documents boost, whatever the similarity.
 type tokenTFIDF struct {
-	tokenTF  map[string]uint32
+	// term is what the postings are of, to explain their score
+	term     string
+	tokenTF  map[uint32]uint32
+	fieldTF  map[string]map[uint32]uint32
 	tokenIDF uint32
+	boost    float32
+	constant bool
 }
 
 func (fulltext *Fulltext) Search(query *Query) (*Hits, error) {
 	start := time.Now()
 	hits := new(Hits)
 	var (
-		err               error
-		scores            map[string]float32
-		tokensTF          map[string]map[string]uint32
-		total             int
-		match             []Doc
-		mustTF, mustNotTF []map[string]uint32
-		tokensTFIDF       []tokenTFIDF
+		err      error
+		clause   Clause
+		scores   map[uint32]float32
+		ids      map[uint32]string
+		total    int
+		match    []Doc
+		snap     Snapshot
+		r        reader
+		mapping  *Mapping
+		settings *Settings
+		e        *executor
 	)
 
 	if query == nil {
@@ -85,209 +177,348 @@ func (fulltext *Fulltext) Search(query *Query) (*Hits, error) {
 	if query.index == "" {
 		goto final
 	}
+	hits.index = query.index
 
-	tokensTFIDF = make([]tokenTFIDF, 0, 7)
-
-	if query.match != "" {
-		var mutex sync.Mutex
-		var eg errgroup.Group
-		tokensTF = make(map[string]map[string]uint32)
+	clause = query.clause()
+	if clause == nil {
+		goto final
+	}
 
-		tokens := fulltext.tokenizer.Seg(query.match)
+	// all lookups of one search see the same state of the index
+	snap, err = fulltext.db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	r = reader{snap}
 
-		for _, token := range tokens {
-			token := token
+	e, err = fulltext.executor(r, query)
+	if err != nil {
+		return nil, err
+	}
+	mapping, settings = e.mapping, e.settings
 
-			if _, exist := fulltext.stopWords[token]; exist {
-				continue
-			}
+	scores, err = clause.eval(e)
+	if err != nil {
+		return nil, err
+	}
 
-			eg.Go(func() error {
-				tf, err := fulltext.tf(query.index, token)
-				if err != nil {
-					return err
-				}
-				if tf == nil {
-					return nil
-				}
+	if len(scores) == 0 {
+		goto final
+	}
 
-				idf, err := fulltext.idf(query.index, token)
-				if err != nil {
-					return err
-				}
+	ids, err = scoredIDs(r, query.index, scores)
+	if err != nil {
+		return nil, err
+	}
 
-				mutex.Lock()
-				defer mutex.Unlock()
+	match = make([]Doc, 0, len(scores))
+	for num, score := range scores {
+		match = append(match, Doc{ID: ids[num], Score: score})
+	}
+	total = len(match)
+	if len(query.sorts) != 0 {
+		if err = sortDocs(r, query.index, match, query.sorts); err != nil {
+			return nil, err
+		}
+	} else {
+		sort.Slice(match, func(i, j int) bool {
+			if match[i].Score != match[j].Score {
+				return match[i].Score > match[j].Score
+			}
+			return match[i].ID < match[j].ID
+		})
+	}
 
-				tokensTF[token] = tf
+	if query.from >= total {
+		goto final
+	}
 
-				tokensTFIDF = append(tokensTFIDF, tokenTFIDF{tokenTF: tf, tokenIDF: idf})
+	if query.size == 0 {
+		query.size = fulltext.retSize
+		if settings != nil && settings.PageSize > 0 {
+			query.size = settings.PageSize
+		}
+	}
 
-				return nil
-			})
+	if query.from < 0 {
+		query.from = 0
+	}
+	for i := query.from; i < total; i++ {
+		if i < total && i < query.from+query.size {
+			hits.Docs = append(hits.Docs, match[i])
+		} else {
+			break
 		}
+	}
+	hits.Total = total
 
-		if err = eg.Wait(); err != nil {
+	if query.source {
+		if err = r.fillSource(query.index, hits.Docs, query.sourceFields); err != nil {
 			return nil, err
 		}
 	}
 
-	if len(query.should) != 0 {
-		for _, shouldStr := range query.should {
-			if _, exist := tokensTF[shouldStr]; !exist {
-				tf, err := fulltext.tf(query.index, shouldStr)
-				if err != nil {
-					return nil, err
-				}
-				if tf != nil {
-					idf, err := fulltext.idf(query.index, shouldStr)
-					if err != nil {
-						return nil, err
-					}
-					tokensTFIDF = append(tokensTFIDF, tokenTFIDF{tokenTF: tf, tokenIDF: idf})
-				}
-			}
+	if query.highlighter != nil {
+		if err = fulltext.fillHighlights(r, query, mapping, hits.Docs); err != nil {
+			return nil, err
 		}
 	}
 
-	if len(query.must) != 0 {
-		for _, mustStr := range query.must {
-			if tokenTF, exist := tokensTF[mustStr]; exist {
-
-				mustTF = append(mustTF, tokenTF)
-			} else {
-				tf, err := fulltext.tf(query.index, mustStr)
-				if err != nil {
-					return nil, err
-				}
-				if tf != nil {
-					idf, err := fulltext.idf(query.index, mustStr)
-					if err != nil {
-						return nil, err
-					}
-					tokensTFIDF = append(tokensTFIDF, tokenTFIDF{tokenTF: tf, tokenIDF: idf})
-
-					mustTF = append(mustTF, tf)
-				}
-			}
+	if query.explain {
+		if err = e.fillExplanations(clause, ids, hits.Docs); err != nil {
+			return nil, err
 		}
 	}
 
-	if len(tokensTFIDF) == 0 {
-		goto final
+final:
+	if query != nil && query.spellCheck && query.match != "" && hits.Total <= query.spellMaxHits {
+		if hits.Suggestions, err = fulltext.SpellCheck(query.index, query.match); err != nil {
+			return nil, err
+		}
 	}
 
-	if len(query.mustNot) != 0 {
-		for _, mustNotStr := range query.mustNot {
-			if tokenTF, exist := tokensTF[mustNotStr]; exist {
+	hits.Took = int(time.Now().Sub(start).Milliseconds())
 
-				mustNotTF = append(mustNotTF, tokenTF)
-			} else {
-				tf, err := fulltext.tf(query.index, mustNotStr)
-				if err != nil {
-					return nil, err
-				}
-				if tf != nil {
-					mustNotTF = append(mustNotTF, tf)
-				}
-			}
-		}
-	}
+	return hits, nil
+}
 
-	for _, tfidf := range tokensTFIDF {
-		for id := range tfidf.tokenTF {
-			for _, tf := range mustTF {
-				if _, exist := tf[id]; !exist {
-					delete(tfidf.tokenTF, id)
-				}
-			}
-			for _, tf := range mustNotTF {
-				if _, exist := tf[id]; exist {
-					delete(tfidf.tokenTF, id)
-				}
-			}
-		}
+// executor sets up the evaluation of the query tree of query.
+func (fulltext *Fulltext) executor(r reader, query *Query) (*executor, error) {
+	if err := r.checkLayout(query.index); err != nil {
+		return nil, err
 	}
 
-	scores, err = fulltext.score(query.index, tokensTFIDF)
+	mapping, err := r.mapping(query.index)
 	if err != nil {
 		return nil, err
 	}
-
-	if len(scores) == 0 {
-		goto final
+	settings, err := r.settings(query.index)
+	if err != nil {
+		return nil, err
+	}
+	similarity, err := fulltext.similarity(query.index, settings)
+	if err != nil {
+		return nil, err
 	}
 
-	match = make([]Doc, 0, len(scores))
-	for id, score := range scores {
-		match = append(match, Doc{ID: id, Score: score})
+	fields := query.fields
+	if len(fields) == 0 {
+		fields = mapping.textFields()
 	}
-	total = len(match)
-	sort.Slice(match, func(i, j int) bool {
-		if match[i].Score != match[j].Score {
-			return match[i].Score > match[j].Score
+
+	return &executor{
+		fulltext:   fulltext,
+		r:          r,
+		i:          query.index,
+		mapping:    mapping,
+		settings:   settings,
+		similarity: similarity,
+		query:      query,
+		fields:     fields,
+	}, nil
+}
+
+// fieldGroup are searched fields sharing an analyzer, so a query text is
+// analysed once for all of them.
+type fieldGroup struct {
+	analyzer *Analyzer
+	fields   []string
+}
+
+func (fulltext *Fulltext) fieldGroups(mapping *Mapping, fields []string) ([]fieldGroup, error) {
+	var groups []fieldGroup
+	for _, field := range fields {
+		analyzer, err := fulltext.analyzer(mapping, field)
+		if err != nil {
+			return nil, err
 		}
-		return match[i].ID < match[j].ID
-	})
 
-	if query.from >= total {
-		goto final
+		found := false
+		for k := range groups {
+			if groups[k].analyzer == analyzer {
+				groups[k].fields = append(groups[k].fields, field)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, fieldGroup{analyzer, []string{field}})
+		}
 	}
+	return groups, nil
+}
 
-	if query.size == 0 {
-		query.size = fulltext.retSize
-	}
+// termTF loads the postings of token in fields, nil if no field has it.
+func termTF(r reader, i string, fields []string, token string) (*tokenTFIDF, error) {
+	tfidf := &tokenTFIDF{term: token, tokenTF: make(map[uint32]uint32), fieldTF: make(map[string]map[uint32]uint32), boost: 1}
+	for _, field := range fields {
+		tf, err := r.tf(i, field, token)
+		if err != nil {
+			return nil, err
+		}
+		if tf == nil {
+			continue
+		}
 
-	for i := query.from; i < total; i++ {
-		if i < total && i < query.from+query.size {
-			hits.Docs = append(hits.Docs, match[i])
-		} else {
-			break
+		tfidf.fieldTF[field] = tf
+		for num, tfVal := range tf {
+			tfidf.tokenTF[num] += tfVal
 		}
 	}
-	hits.Total = total
+	if len(tfidf.fieldTF) == 0 {
+		return nil, nil
+	}
+	tfidf.tokenIDF = uint32(len(tfidf.tokenTF))
 
-final:
-	hits.Took = int(time.Now().Sub(start).Milliseconds())
+	return tfidf, nil
+}
 
-	return hits, nil
+// scoredIDs resolves the numbers of the scored documents to their ids.
+func scoredIDs(r reader, i string, scores map[uint32]float32) (map[uint32]string, error) {
+	nums := make(map[uint32]struct{}, len(scores))
+	for num := range scores {
+		nums[num] = struct{}{}
+	}
+
+	return r.docIDs(i, nums)
+}
+
+// scorer scores postings with the statistics of the fields they are in.
+type scorer struct {
+	mapping    *Mapping
+	similarity Similarity
+	ds         uint32
+	totals     map[string]uint64
+	means      map[string]float32
+	lens       map[string]map[uint32]uint32
 }
 
-func (fulltext *Fulltext) score(i string, tokensTFIDF []tokenTFIDF) (map[string]float32, error) {
-	ts, err := fulltext.ts(i)
+// score sums the scores of the tokens given by the similarity of the index.
+func (fulltext *Fulltext) score(r reader, i string, mapping *Mapping, similarity Similarity, tokensTFIDF []tokenTFIDF) (map[uint32]float32, error) {
+	s, err := newScorer(r, i, mapping, similarity, tokensTFIDF)
 	if err != nil {
 		return nil, err
 	}
+	return s.score(tokensTFIDF), nil
+}
 
-	ds, err := fulltext.ds(i)
+// newScorer loads the lengths of the fields of the documents holding the
+// tokens, and the statistics of the fields over the index.
+func newScorer(r reader, i string, mapping *Mapping, similarity Similarity, tokensTFIDF []tokenTFIDF) (*scorer, error) {
+	ds, err := r.ds(i)
 	if err != nil {
 		return nil, err
 	}
 
-	var mean float32
-	if ds != 0 {
-		mean = float32(float64(ts) / float64(ds))
+	fieldsNums := make(map[string]map[uint32]struct{})
+	for _, tfidf := range tokensTFIDF {
+		for field, tf := range tfidf.fieldTF {
+			if _, exist := fieldsNums[field]; !exist {
+				fieldsNums[field] = make(map[uint32]struct{})
+			}
+			for num := range tfidf.tokenTF {
+				if _, exist := tf[num]; exist {
+					fieldsNums[field][num] = struct{}{}
+				}
+			}
+		}
+	}
+
+	s := &scorer{
+		mapping:    mapping,
+		similarity: similarity,
+		ds:         ds,
+		totals:     make(map[string]uint64, len(fieldsNums)),
+		means:      make(map[string]float32, len(fieldsNums)),
+		lens:       make(map[string]map[uint32]uint32, len(fieldsNums)),
 	}
+	for field, nums := range fieldsNums {
+		ts, err := r.ts(i, field)
+		if err != nil {
+			return nil, err
+		}
 
-	scores := make(map[string]float32)
+		s.totals[field] = ts
+		if ds != 0 {
+			s.means[field] = float32(float64(ts) / float64(ds))
+		}
+
+		s.lens[field], err = r.docsLen(i, field, nums)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *scorer) score(tokensTFIDF []tokenTFIDF) map[uint32]float32 {
+	scores := make(map[uint32]float32)
 
 	for _, tfidf := range tokensTFIDF {
 		if len(tfidf.tokenTF) != 0 {
 
-			idf := float32(math.Log(float64(1 + (float32(ds)-float32(tfidf.tokenIDF)+0.5)/(float32(tfidf.tokenIDF)+0.5))))
-
-			for id, tfVal := range tfidf.tokenTF {
+			term, fields := s.stats(tfidf)
 
-				tf := (float32(tfVal) * (fulltext.k1 + 1)) / (float32(tfVal) + fulltext.k1*(1-fulltext.b+fulltext.b*(float32(ds)/mean)))
+			docFields := make([]FieldStats, 0, len(fields))
+			for num := range tfidf.tokenTF {
+				if tfidf.constant {
+					scores[num] += tfidf.boost
+					continue
+				}
 
-				if _, exist := scores[id]; !exist {
-					scores[id] = tf * idf
-				} else {
-					scores[id] += tf * idf
+				docFields = s.docFields(tfidf, fields, num, docFields[:0])
+				if len(docFields) == 0 {
+					continue
 				}
+
+				scores[num] += s.similarity.Score(term, docFields) * tfidf.boost
 			}
 		}
 	}
 
-	return scores, nil
+	return scores
+}
+
+// stats returns the statistics of a token over the index, the ones of its
+// fields in the order of their names so the documents are scored the same
+// way every time.
+func (s *scorer) stats(tfidf tokenTFIDF) (TermStats, []FieldStats) {
+	term := TermStats{DocCount: s.ds, DocFreq: tfidf.tokenIDF}
+
+	// the postings of the fields are complete, only tokenTF is filtered
+	fields := make([]FieldStats, 0, len(tfidf.fieldTF))
+	for field, tf := range tfidf.fieldTF {
+		f := FieldStats{
+			Field:    field,
+			Boost:    s.mapping.field(field).boost(),
+			AvgLen:   s.means[field],
+			DocFreq:  uint32(len(tf)),
+			TotalLen: s.totals[field],
+		}
+		for _, tfVal := range tf {
+			f.TotalFreq += uint64(tfVal)
+		}
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+
+	return term, fields
+}
+
+// docFields appends the statistics of the fields of document num holding the
+// token to docFields.
+func (s *scorer) docFields(tfidf tokenTFIDF, fields []FieldStats, num uint32, docFields []FieldStats) []FieldStats {
+	for _, f := range fields {
+		fieldTF, exist := tfidf.fieldTF[f.Field][num]
+		if !exist {
+			continue
+		}
+
+		f.Freq = fieldTF
+		f.Len = s.lens[f.Field][num]
+		docFields = append(docFields, f)
+	}
+	return docFields
 }
@@ -0,0 +1,84 @@
+package seg
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// BigramTokenizer cuts Chinese, Japanese and Korean without a dictionary: a
+// run of CJK characters gives its overlapping pairs of characters, a single
+// character gives itself. The runs of other characters, Latin words and
+// numbers, are cut by Words, a WordTokenizer when nil.
+//
+// Bigrams find any word at the cost of some false matches and a larger
+// index. For precision too, a field can be indexed twice, with a
+// GseTokenizer and a BigramTokenizer.
+type BigramTokenizer struct {
+	Words interface {
+		Seg(text string) []string
+	}
+}
+
+func (t *BigramTokenizer) Seg(text string) []string {
+	words := t.Words
+	if words == nil {
+		words = &WordTokenizer{}
+	}
+
+	var tokens []string
+	start := 0
+	for i := 0; i < len(text); {
+		c, w := utf8.DecodeRuneInString(text[i:])
+		if !cjk(c) {
+			i += w
+			continue
+		}
+
+		if start < i {
+			tokens = append(tokens, words.Seg(text[start:i])...)
+		}
+
+		end := i
+		for end < len(text) {
+			c, w := utf8.DecodeRuneInString(text[end:])
+			if !cjk(c) {
+				break
+			}
+			end += w
+		}
+		tokens = append(tokens, bigrams(text[i:end])...)
+		i, start = end, end
+	}
+	if start < len(text) {
+		tokens = append(tokens, words.Seg(text[start:])...)
+	}
+
+	return tokens
+}
+
+// cjk tells whether c is a CJK character. The prolonged sound mark ー of
+// katakana is common to both kana.
+func cjk(c rune) bool {
+	return unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || c == 'ー'
+}
+
+// bigrams returns the overlapping pairs of characters of run, or run itself
+// when it is a single character.
+func bigrams(run string) []string {
+	_, first := utf8.DecodeRuneInString(run)
+	if first == len(run) {
+		return []string{run}
+	}
+
+	var tokens []string
+	for i := 0; i < len(run); {
+		_, w1 := utf8.DecodeRuneInString(run[i:])
+		if i+w1 == len(run) {
+			break
+		}
+		_, w2 := utf8.DecodeRuneInString(run[i+w1:])
+		tokens = append(tokens, run[i:i+w1+w2])
+		i += w1
+	}
+	return tokens
+}
@@ -0,0 +1,26 @@
+package seg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBigramTokenizer(t *testing.T) {
+	tests := []struct {
+		text   string
+		tokens []string
+	}{
+		{"信息检索", []string{"信息", "息检", "检索"}},
+		{"在 BM25 中", []string{"在", "bm25", "中"}},
+		{"搜索引擎，Search engines!", []string{"搜索", "索引", "引擎", "search", "engines"}},
+		{"東京タワー", []string{"東京", "京タ", "タワ", "ワー"}},
+		{"한국어 text", []string{"한국", "국어", "text"}},
+	}
+
+	for _, test := range tests {
+		tokens := (&BigramTokenizer{}).Seg(test.text)
+		if !reflect.DeepEqual(tokens, test.tokens) {
+			t.Fatalf("%q: %q, want %q", test.text, tokens, test.tokens)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package seg
+
+import (
+	"github.com/744189447/fulltext/stem"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WordTokenizer cuts a text into lowercase words at the word boundaries of
+// Unicode (UAX #29), without any dictionary:
+//
+//   - letters and digits make words, punctuation and spaces are dropped
+//   - an apostrophe or a dot between letters, and a dot or a comma between
+//     digits, stays inside the word: don't, u.s.a, 3.14, 1,000
+//   - an underscore joins words, a hyphen splits them
+//   - the possessive 's is removed and ’ is written '
+//   - URLs and emails are kept whole
+//   - Chinese characters and hiragana are words of their own
+//
+// With Stem the words are also reduced by the Porter stemmer. The stemmed
+// words can not be found back in the text by the highlighter, a
+// fulltext.StemFilter after the tokenizer keeps them highlighted.
+type WordTokenizer struct {
+	Stem bool
+}
+
+func (t *WordTokenizer) Seg(text string) []string {
+	var words []string
+	for i := 0; i < len(text); {
+		c, w := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case !wordRune(c):
+			i += w
+			continue
+		case ideographic(c):
+			words = append(words, string(c))
+			i += w
+			continue
+		}
+
+		if n := urlLen(text[i:]); n > 0 {
+			words = append(words, strings.ToLower(text[i:i+n]))
+			i += n
+			continue
+		}
+		if n := emailLen(text[i:]); n > 0 {
+			words = append(words, strings.ToLower(text[i:i+n]))
+			i += n
+			continue
+		}
+
+		n := wordLen(text[i:])
+		if word := t.word(text[i : i+n]); word != "" {
+			words = append(words, word)
+		}
+		i += n
+	}
+
+	return words
+}
+
+func (t *WordTokenizer) word(word string) string {
+	word = strings.ToLower(word)
+	word = strings.ReplaceAll(word, "’", "'")
+	word = strings.TrimSuffix(word, "'s")
+	if t.Stem {
+		word = stem.Porter(word)
+	}
+	return word
+}
+
+func wordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsNumber(c) || unicode.IsMark(c)
+}
+
+func ideographic(c rune) bool {
+	return unicode.Is(unicode.Han, c) || unicode.Is(unicode.Hiragana, c)
+}
+
+// wordLen returns the length of the word s starts with.
+func wordLen(s string) int {
+	var prev rune
+	i := 0
+	for i < len(s) {
+		c, w := utf8.DecodeRuneInString(s[i:])
+		if wordRune(c) && !ideographic(c) {
+			prev = c
+			i += w
+			continue
+		}
+
+		next, _ := utf8.DecodeRuneInString(s[i+w:])
+		if !joins(prev, c, next) {
+			break
+		}
+		i += w
+	}
+	return i
+}
+
+// joins tells whether the punctuation c keeps the characters around it in
+// the same word.
+func joins(prev, c, next rune) bool {
+	letters := unicode.IsLetter(prev) && unicode.IsLetter(next)
+	digits := unicode.IsNumber(prev) && unicode.IsNumber(next)
+	switch c {
+	case '\'', '’', '.':
+		return letters || digits
+	case ',':
+		return digits
+	case '_':
+		return wordRune(next) && !ideographic(next)
+	}
+	return false
+}
+
+// urlLen returns the length of the URL s starts with, 0 if it starts with
+// none. A URL has a scheme, like http://, or starts with www.
+func urlLen(s string) int {
+	i := 0
+	for i < len(s) && (isASCIILetter(s[i]) || i > 0 && (isASCIIDigit(s[i]) || strings.IndexByte("+.-", s[i]) >= 0)) {
+		i++
+	}
+	switch {
+	case i > 0 && strings.HasPrefix(s[i:], "://"):
+		i += 3
+	case len(s) > 4 && strings.EqualFold(s[:4], "www."):
+		i = 4
+	default:
+		return 0
+	}
+
+	start := i
+	for i < len(s) {
+		c, w := utf8.DecodeRuneInString(s[i:])
+		if unicode.IsSpace(c) || strings.ContainsRune("<>\"", c) {
+			break
+		}
+		i += w
+	}
+	for i > start && strings.IndexByte(".,;:!?')]}", s[i-1]) >= 0 {
+		i--
+	}
+	if i == start {
+		return 0
+	}
+	return i
+}
+
+// emailLen returns the length of the email address s starts with, 0 if it
+// starts with none.
+func emailLen(s string) int {
+	i := 0
+	for i < len(s) && (isASCIILetter(s[i]) || isASCIIDigit(s[i]) || strings.IndexByte("._%+-", s[i]) >= 0) {
+		i++
+	}
+	if i == 0 || i == len(s) || s[i] != '@' {
+		return 0
+	}
+
+	i++
+	start := i
+	for i < len(s) && (isASCIILetter(s[i]) || isASCIIDigit(s[i]) || s[i] == '.' || s[i] == '-') {
+		i++
+	}
+	for i > start && (s[i-1] == '.' || s[i-1] == '-') {
+		i--
+	}
+	dot := strings.LastIndexByte(s[start:i], '.')
+	if dot <= 0 || start+dot+1 == i {
+		return 0
+	}
+	return i
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isASCIIDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
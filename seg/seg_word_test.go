@@ -0,0 +1,31 @@
+package seg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWordTokenizer(t *testing.T) {
+	tests := []struct {
+		text  string
+		stem  bool
+		words []string
+	}{
+		{"Search, search; SEARCH!", false, []string{"search", "search", "search"}},
+		{"Don’t stop John's car", false, []string{"don't", "stop", "john", "car"}},
+		{"state-of-the-art foo_bar", false, []string{"state", "of", "the", "art", "foo_bar"}},
+		{"pi is 3.14, not 1,000. U.S.A. v1.2", false, []string{"pi", "is", "3.14", "not", "1,000", "u.s.a", "v1.2"}},
+		{"Mail John.Doe@Example.com, or see (https://example.com/a?b=1).", false, []string{"mail", "john.doe@example.com", "or", "see", "https://example.com/a?b=1"}},
+		{"www.golang.org is nice", false, []string{"www.golang.org", "is", "nice"}},
+		{"Café naïve", false, []string{"café", "naïve"}},
+		{"搜索引擎 and ひらがな", false, []string{"搜", "索", "引", "擎", "and", "ひ", "ら", "が", "な"}},
+		{"Running connections", true, []string{"run", "connect"}},
+	}
+
+	for _, test := range tests {
+		words := (&WordTokenizer{Stem: test.stem}).Seg(test.text)
+		if !reflect.DeepEqual(words, test.words) {
+			t.Fatalf("%q: %q, want %q", test.text, words, test.words)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package fulltext
+
+import (
+	"fmt"
+)
+
+// Names of the built-in similarities in SimilaritySettings.
+const (
+	SimilarityBM25            = "bm25"
+	SimilarityBM25Plus        = "bm25+"
+	SimilarityTFIDF           = "tfidf"
+	SimilarityLMDirichlet     = "lm_dirichlet"
+	SimilarityLMJelinekMercer = "lm_jelinek_mercer"
+)
+
+// Settings are stored with an index, so they are restored when it is opened
+// again.
+type Settings struct {
+	Similarity SimilaritySettings
+	// PageSize is the number of hits returned when a query sets no size, 0
+	// for the page size of the Fulltext.
+	PageSize int
+}
+
+// SimilaritySettings choose a built-in similarity by name, "" for the
+// similarity of the Fulltext. Params override its parameters: k1 and b for
+// bm25, k1, b and delta for bm25+, mu for lm_dirichlet and lambda for
+// lm_jelinek_mercer.
+type SimilaritySettings struct {
+	Name   string
+	Params map[string]float32
+}
+
+func (s SimilaritySettings) similarity() (Similarity, error) {
+	switch s.Name {
+	case "":
+		return nil, nil
+	case SimilarityBM25:
+		bm25 := NewBM25()
+		err := s.set(map[string]*float32{"k1": &bm25.K1, "b": &bm25.B})
+		return bm25, err
+	case SimilarityBM25Plus:
+		bm25 := NewBM25Plus()
+		err := s.set(map[string]*float32{"k1": &bm25.K1, "b": &bm25.B, "delta": &bm25.Delta})
+		return bm25, err
+	case SimilarityTFIDF:
+		return TFIDF{}, s.set(nil)
+	case SimilarityLMDirichlet:
+		lm := NewLMDirichlet()
+		err := s.set(map[string]*float32{"mu": &lm.Mu})
+		return lm, err
+	case SimilarityLMJelinekMercer:
+		lm := NewLMJelinekMercer()
+		err := s.set(map[string]*float32{"lambda": &lm.Lambda})
+		return lm, err
+	}
+
+	return nil, fmt.Errorf("fulltext/settings: unknown similarity %q", s.Name)
+}
+
+// set copies Params to the parameters of the similarity.
+func (s SimilaritySettings) set(params map[string]*float32) error {
+	for name, v := range s.Params {
+		p, exist := params[name]
+		if !exist {
+			return fmt.Errorf("fulltext/settings: similarity %s has no parameter %q", s.Name, name)
+		}
+		*p = v
+	}
+	return nil
+}
+
+// PutSettings stores the settings of index, replacing the previous ones.
+func (fulltext *Fulltext) PutSettings(index string, settings Settings) error {
+	if _, err := settings.Similarity.similarity(); err != nil {
+		return err
+	}
+
+	unlock := fulltext.lock(index)
+	defer unlock()
+
+	val, err := anyToByte(settings)
+	if err != nil {
+		return err
+	}
+
+	batch := fulltext.db.NewBatch()
+	batch.Put([]byte(fmt.Sprintf("%s:%s:%s", indexKey, index, settingsKey)), val)
+	return fulltext.db.Write(batch)
+}
+
+// Settings returns the stored settings of index, nil if it has none.
+func (fulltext *Fulltext) Settings(index string) (*Settings, error) {
+	return reader{fulltext.db}.settings(index)
+}
+
+func (r reader) settings(i string) (*Settings, error) {
+	val, err := r.Get([]byte(fmt.Sprintf("%s:%s:%s", indexKey, i, settingsKey)))
+	if err != nil || len(val) == 0 {
+		return nil, err
+	}
+
+	settings := &Settings{}
+	if err = byteToAny(val, settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
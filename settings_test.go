@@ -0,0 +1,93 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFulltextSettings(t *testing.T) {
+	index := "settings"
+	dir := t.TempDir()
+	docs := map[string]string{"document_0": "okapi bm25", "document_1": "okapi", "document_2": "tf idf"}
+
+	open := func() *Fulltext {
+		fulltext, err := New(dir, &seg.EnTokenizer{}, WithStopWords("a"), WithCacheSize(1<<20), WithWriteBuffer(1<<20), WithCompression(false), WithPageSize(5))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return fulltext
+	}
+
+	fulltext := open()
+	if err := fulltext.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+	err := fulltext.PutSettings(index, Settings{Similarity: SimilaritySettings{Name: "nope"}})
+	if err == nil {
+		t.Fatal("unknown similarity stored")
+	}
+	err = fulltext.PutSettings(index, Settings{Similarity: SimilaritySettings{Name: SimilarityBM25, Params: map[string]float32{"mu": 1}}})
+	if err == nil {
+		t.Fatal("unknown parameter stored")
+	}
+	err = fulltext.PutSettings(index, Settings{Similarity: SimilaritySettings{Name: SimilarityBM25, Params: map[string]float32{"k1": 2, "b": 0}}, PageSize: 1})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = fulltext.Free(); err != nil {
+		log.Fatal(err)
+	}
+
+	fulltext = open()
+	defer fulltext.Free()
+
+	settings, err := fulltext.Settings(index)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if settings == nil || settings.PageSize != 1 || settings.Similarity.Params["k1"] != 2 {
+		t.Fatalf("settings: %+v", settings)
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("okapi"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// scored as a fresh index searched with the same bm25
+	want, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{}, WithSimilarity(BM25{K1: 2}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer want.Free()
+	if err = want.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+	wantHits, err := want.Search(new(Query).Index(index).Match("okapi"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if hits.Total != 2 || len(hits.Docs) != 1 || len(wantHits.Docs) != 2 || hits.Docs[0].Score != wantHits.Docs[0].Score {
+		t.Fatalf("hits: %+v, want %+v", hits.Docs, wantHits.Docs)
+	}
+
+	stopWords := path.Join(t.TempDir(), "stop.txt")
+	if err = os.WriteFile(stopWords, []byte("okapi\n"), 0644); err != nil {
+		log.Fatal(err)
+	}
+	stopped, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{}, WithStopWordFile(stopWords))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer stopped.Free()
+	if err = stopped.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+	if hits, err = stopped.Search(new(Query).Index(index).Should("okapi")); err != nil || hits.Total != 0 {
+		t.Fatalf("stop word indexed: %+v %v", hits, err)
+	}
+}
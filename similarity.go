@@ -0,0 +1,346 @@
+package fulltext
+
+import (
+	"fmt"
+	"math"
+)
+
+// Similarity scores a term, or a phrase, in a document from the statistics
+// of the index. The scores of the terms of a query are summed.
+type Similarity interface {
+	Score(term TermStats, fields []FieldStats) float32
+}
+
+// Explainer is a Similarity explaining how it scores a term, see
+// Fulltext.Explain. The value of the explanation is the score.
+type Explainer interface {
+	Explain(term TermStats, fields []FieldStats) Explanation
+}
+
+// TermStats are the statistics of a term over the searched fields.
+type TermStats struct {
+	// DocCount is the number of documents in the index.
+	DocCount uint32
+	// DocFreq is the number of documents holding the term in any field.
+	DocFreq uint32
+}
+
+// FieldStats are the statistics of a term in one field of a document, for
+// the fields holding it.
+type FieldStats struct {
+	// Field is the name of the field.
+	Field string
+	Boost float32
+	Freq  uint32
+	// Len is the length of the field in the document, AvgLen the average
+	// over the documents of the index.
+	Len    uint32
+	AvgLen float32
+	// DocFreq is the number of documents holding the term in the field,
+	// TotalFreq the number of its occurrences in the field of every document
+	// and TotalLen the number of tokens in the field of every document.
+	DocFreq   uint32
+	TotalFreq uint64
+	TotalLen  uint64
+}
+
+// BM25 is BM25F: the frequencies of the fields are length normalized and
+// weighted by the field boost before they are saturated.
+type BM25 struct {
+	K1 float32
+	B  float32
+}
+
+func NewBM25() BM25 {
+	return BM25{K1: 1.4, B: 0.75}
+}
+
+func (s BM25) Score(term TermStats, fields []FieldStats) float32 {
+	tf := bm25TF(s.B, fields)
+	if tf == 0 {
+		return 0
+	}
+
+	return bm25IDF(term) * (tf * (s.K1 + 1)) / (tf + s.K1)
+}
+
+func (s BM25) Explain(term TermStats, fields []FieldStats) Explanation {
+	return Explanation{
+		Value:       s.Score(term, fields),
+		Description: "bm25, idf * tf * (k1 + 1) / (tf + k1)",
+		Details: []Explanation{
+			explainBM25IDF(term),
+			explainBM25TF(s.B, fields),
+			{Value: s.K1, Description: "k1"},
+		},
+	}
+}
+
+// BM25Plus adds Delta to the saturated frequency of BM25, so that a match in
+// a very long document still scores more than no match.
+type BM25Plus struct {
+	K1    float32
+	B     float32
+	Delta float32
+}
+
+func NewBM25Plus() BM25Plus {
+	return BM25Plus{K1: 1.4, B: 0.75, Delta: 1}
+}
+
+func (s BM25Plus) Score(term TermStats, fields []FieldStats) float32 {
+	tf := bm25TF(s.B, fields)
+	if tf == 0 {
+		return 0
+	}
+
+	return bm25IDF(term) * ((tf*(s.K1+1))/(tf+s.K1) + s.Delta)
+}
+
+func (s BM25Plus) Explain(term TermStats, fields []FieldStats) Explanation {
+	return Explanation{
+		Value:       s.Score(term, fields),
+		Description: "bm25+, idf * (tf * (k1 + 1) / (tf + k1) + delta)",
+		Details: []Explanation{
+			explainBM25IDF(term),
+			explainBM25TF(s.B, fields),
+			{Value: s.K1, Description: "k1"},
+			{Value: s.Delta, Description: "delta"},
+		},
+	}
+}
+
+func bm25IDF(term TermStats) float32 {
+	n, df := float32(term.DocCount), float32(term.DocFreq)
+	return float32(math.Log(float64(1 + (n-df+0.5)/(df+0.5))))
+}
+
+func explainBM25IDF(term TermStats) Explanation {
+	return Explanation{
+		Value:       bm25IDF(term),
+		Description: "idf, log(1 + (N - df + 0.5) / (df + 0.5))",
+		Details:     explainTermStats(term),
+	}
+}
+
+// bm25TF is the pseudo frequency of BM25F.
+func bm25TF(b float32, fields []FieldStats) float32 {
+	var tf float32
+	for _, f := range fields {
+		tf += bm25FieldTF(b, f)
+	}
+	return tf
+}
+
+// bm25FieldTF is the length normalized frequency of a field.
+func bm25FieldTF(b float32, f FieldStats) float32 {
+	var norm float32 = 1
+	if f.AvgLen != 0 {
+		norm = float32(f.Len) / f.AvgLen
+	}
+
+	return f.Boost * float32(f.Freq) / (1 - b + b*norm)
+}
+
+func explainBM25TF(b float32, fields []FieldStats) Explanation {
+	tf := Explanation{Value: bm25TF(b, fields), Description: "tf, sum of the fields"}
+	for _, f := range fields {
+		tf.Details = append(tf.Details, Explanation{
+			Value:       bm25FieldTF(b, f),
+			Description: fmt.Sprintf("field %q, boost * freq / (1 - b + b * len / avgLen)", f.Field),
+			Details:     explainFieldStats(f),
+		})
+	}
+	tf.Details = append(tf.Details, Explanation{Value: b, Description: "b"})
+	return tf
+}
+
+// TFIDF is the classic vector space scoring: per field the square root of
+// the frequency, divided by the square root of the length, times the square
+// of the idf, summed over the fields weighted by their boost.
+type TFIDF struct{}
+
+func (TFIDF) Score(term TermStats, fields []FieldStats) float32 {
+	idf := tfidfIDF(term)
+
+	var score float64
+	for _, f := range fields {
+		score += tfidfField(f, idf)
+	}
+	return float32(score)
+}
+
+func (s TFIDF) Explain(term TermStats, fields []FieldStats) Explanation {
+	idf := tfidfIDF(term)
+	e := Explanation{
+		Value:       s.Score(term, fields),
+		Description: "tfidf, sum of the fields",
+		Details: []Explanation{{
+			Value:       float32(idf),
+			Description: "idf, 1 + log((N + 1) / (df + 1))",
+			Details:     explainTermStats(term),
+		}},
+	}
+	for _, f := range fields {
+		e.Details = append(e.Details, Explanation{
+			Value:       float32(tfidfField(f, idf)),
+			Description: fmt.Sprintf("field %q, boost * sqrt(freq) * idf * idf / sqrt(len)", f.Field),
+			Details:     explainFieldStats(f),
+		})
+	}
+	return e
+}
+
+func tfidfIDF(term TermStats) float64 {
+	return 1 + math.Log(float64(term.DocCount+1)/float64(term.DocFreq+1))
+}
+
+func tfidfField(f FieldStats, idf float64) float64 {
+	norm := 1.0
+	if f.Len > 0 {
+		norm = 1 / math.Sqrt(float64(f.Len))
+	}
+
+	return float64(f.Boost) * math.Sqrt(float64(f.Freq)) * idf * idf * norm
+}
+
+// LMDirichlet is the query likelihood of a language model smoothed with a
+// Dirichlet prior of weight Mu. Negative field scores are cut to 0.
+type LMDirichlet struct {
+	Mu float32
+}
+
+func NewLMDirichlet() LMDirichlet {
+	return LMDirichlet{Mu: 2000}
+}
+
+func (s LMDirichlet) Score(term TermStats, fields []FieldStats) float32 {
+	var score float64
+	for _, f := range fields {
+		score += s.field(f)
+	}
+	return float32(score)
+}
+
+func (s LMDirichlet) field(f FieldStats) float64 {
+	mu := float64(s.Mu)
+	p := collectionProb(f)
+	fs := math.Log(1+float64(f.Freq)/(mu*p)) + math.Log(mu/(float64(f.Len)+mu))
+	if fs > 0 {
+		return float64(f.Boost) * fs
+	}
+	return 0
+}
+
+func (s LMDirichlet) Explain(term TermStats, fields []FieldStats) Explanation {
+	e := Explanation{Value: s.Score(term, fields), Description: "lm dirichlet, sum of the fields"}
+	for _, f := range fields {
+		e.Details = append(e.Details, Explanation{
+			Value:       float32(s.field(f)),
+			Description: fmt.Sprintf("field %q, boost * max(0, log(1 + freq / (mu * p)) + log(mu / (len + mu)))", f.Field),
+			Details:     append(explainFieldStats(f), explainCollectionProb(f)),
+		})
+	}
+	e.Details = append(e.Details, Explanation{Value: s.Mu, Description: "mu"})
+	return e
+}
+
+// LMJelinekMercer is the query likelihood of a language model interpolated
+// with the collection model, Lambda being the weight of the collection.
+type LMJelinekMercer struct {
+	Lambda float32
+}
+
+func NewLMJelinekMercer() LMJelinekMercer {
+	return LMJelinekMercer{Lambda: 0.7}
+}
+
+func (s LMJelinekMercer) Score(term TermStats, fields []FieldStats) float32 {
+	var score float64
+	for _, f := range fields {
+		score += s.field(f)
+	}
+	return float32(score)
+}
+
+func (s LMJelinekMercer) field(f FieldStats) float64 {
+	if f.Len == 0 {
+		return 0
+	}
+
+	lambda := float64(s.Lambda)
+	p := collectionProb(f)
+	return float64(f.Boost) * math.Log(1+(1-lambda)*float64(f.Freq)/float64(f.Len)/(lambda*p))
+}
+
+func (s LMJelinekMercer) Explain(term TermStats, fields []FieldStats) Explanation {
+	e := Explanation{Value: s.Score(term, fields), Description: "lm jelinek mercer, sum of the fields"}
+	for _, f := range fields {
+		e.Details = append(e.Details, Explanation{
+			Value:       float32(s.field(f)),
+			Description: fmt.Sprintf("field %q, boost * log(1 + (1 - lambda) * freq / len / (lambda * p))", f.Field),
+			Details:     append(explainFieldStats(f), explainCollectionProb(f)),
+		})
+	}
+	e.Details = append(e.Details, Explanation{Value: s.Lambda, Description: "lambda"})
+	return e
+}
+
+// collectionProb is the probability of the term in the field over every
+// document, smoothed so it is never 0.
+func collectionProb(f FieldStats) float64 {
+	return (float64(f.TotalFreq) + 1) / (float64(f.TotalLen) + 1)
+}
+
+func explainCollectionProb(f FieldStats) Explanation {
+	return Explanation{
+		Value:       float32(collectionProb(f)),
+		Description: "p, (totalFreq + 1) / (totalLen + 1)",
+		Details: []Explanation{
+			{Value: float32(f.TotalFreq), Description: "totalFreq, occurrences of the term in the field"},
+			{Value: float32(f.TotalLen), Description: "totalLen, tokens in the field"},
+		},
+	}
+}
+
+func explainTermStats(term TermStats) []Explanation {
+	return []Explanation{
+		{Value: float32(term.DocCount), Description: "N, documents in the index"},
+		{Value: float32(term.DocFreq), Description: "df, documents holding the term"},
+	}
+}
+
+func explainFieldStats(f FieldStats) []Explanation {
+	return []Explanation{
+		{Value: float32(f.Freq), Description: "freq, occurrences in the field of the document"},
+		{Value: float32(f.Len), Description: "len, tokens in the field of the document"},
+		{Value: f.AvgLen, Description: "avgLen, average tokens in the field"},
+		{Value: f.Boost, Description: "boost of the field"},
+	}
+}
+
+// SetSimilarity sets the similarity index is scored with until the Fulltext
+// is closed, over the one of its settings. With nil the settings, then the
+// similarity of the Fulltext, apply again.
+func (fulltext *Fulltext) SetSimilarity(index string, similarity Similarity) {
+	if similarity == nil {
+		fulltext.similarities.Delete(index)
+		return
+	}
+	fulltext.similarities.Store(index, similarity)
+}
+
+func (fulltext *Fulltext) similarity(index string, settings *Settings) (Similarity, error) {
+	if similarity, exist := fulltext.similarities.Load(index); exist {
+		return similarity.(Similarity), nil
+	}
+
+	if settings != nil {
+		similarity, err := settings.Similarity.similarity()
+		if err != nil || similarity != nil {
+			return similarity, err
+		}
+	}
+
+	return fulltext.defaultSimilarity, nil
+}
@@ -0,0 +1,91 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"math"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	term := TermStats{DocCount: 100, DocFreq: 10}
+	field := func(freq, l uint32) []FieldStats {
+		return []FieldStats{{Boost: 1, Freq: freq, Len: l, AvgLen: 10, DocFreq: 10, TotalFreq: 20, TotalLen: 1000}}
+	}
+
+	similarities := map[string]Similarity{
+		"bm25":  NewBM25(),
+		"bm25+": NewBM25Plus(),
+		"tfidf": TFIDF{},
+		"lmd":   LMDirichlet{Mu: 100},
+		"lmjm":  NewLMJelinekMercer(),
+	}
+	for name, s := range similarities {
+		base := s.Score(term, field(2, 10))
+		if base <= 0 {
+			t.Fatalf("%s: score %f", name, base)
+		}
+		if more := s.Score(term, field(4, 10)); more <= base {
+			t.Fatalf("%s: more occurrences %f <= %f", name, more, base)
+		}
+		if longer := s.Score(term, field(2, 40)); longer >= base {
+			t.Fatalf("%s: longer document %f >= %f", name, longer, base)
+		}
+		if rarer := s.Score(TermStats{DocCount: 100, DocFreq: 2}, field(2, 10)); name != "lmd" && name != "lmjm" && rarer <= base {
+			t.Fatalf("%s: rarer term %f <= %f", name, rarer, base)
+		}
+	}
+
+	// bm25 with b = 0 ignores the length, bm25+ scores delta*idf more
+	bm25 := BM25{K1: 1.2}
+	if bm25.Score(term, field(2, 10)) != bm25.Score(term, field(2, 40)) {
+		t.Fatal("bm25 b=0")
+	}
+	plus := NewBM25Plus().Score(term, field(2, 10)) - NewBM25().Score(term, field(2, 10))
+	if idf := bm25IDF(term); math.Abs(float64(plus-idf)) > 1e-5 {
+		t.Fatalf("bm25+ delta: %f, idf %f", plus, idf)
+	}
+
+	// log(1 + 2/(100*21/1001)) + log(100/110)
+	want := math.Log(1+2/(100*21.0/1001)) + math.Log(100.0/110)
+	if got := similarities["lmd"].Score(term, field(2, 10)); math.Abs(float64(got)-want) > 1e-5 {
+		t.Fatalf("dirichlet: %f want %f", got, want)
+	}
+}
+
+func TestFulltextSimilarity(t *testing.T) {
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	docs := map[string]string{
+		"document_0": "okapi",
+		"document_1": "okapi okapi okapi okapi okapi okapi okapi okapi bm25 ranking function a b c d e f g h",
+	}
+	for _, index := range []string{"bm25", "tfidf"} {
+		if err = fulltext.AddDocs(index, docs); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fulltext.SetSimilarity("tfidf", TFIDF{})
+
+	search := func(index string) *Hits {
+		hits, err := fulltext.Search(new(Query).Index(index).Match("okapi"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return hits
+	}
+
+	bm25, tfidf := search("bm25"), search("tfidf")
+	if bm25.Total != 2 || tfidf.Total != 2 || bm25.Docs[0].Score == tfidf.Docs[0].Score {
+		t.Fatalf("bm25 %+v, tfidf %+v", bm25.Docs, tfidf.Docs)
+	}
+
+	fulltext.SetSimilarity("tfidf", nil)
+	if again := search("tfidf"); again.Docs[0].Score != bm25.Docs[0].Score {
+		t.Fatalf("reset: %+v", again.Docs)
+	}
+}
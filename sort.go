@@ -0,0 +1,113 @@
+package fulltext
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ScoreField stands for the score of the documents in Query.Sort.
+const ScoreField = "_score"
+
+type sortField struct {
+	field string
+	desc  bool
+}
+
+// Sort orders the hits by field, after the fields of previous calls, instead
+// of by score. The documents are compared by the first stored value of
+// field, see Mapping.Source, as numbers when both are, and the ones without
+// a value come last. Field can be ScoreField.
+func (query *Query) Sort(field string, desc bool) *Query {
+	query.sorts = append(query.sorts, sortField{field, desc})
+	return query
+}
+
+// sortDocs orders docs by the sort fields, then by score and id.
+func sortDocs(r reader, i string, docs []Doc, sorts []sortField) error {
+	values := make([][]string, len(docs))
+	for k := range docs {
+		values[k] = make([]string, len(sorts))
+		var fields map[string][]string
+		for n, s := range sorts {
+			if s.field == ScoreField {
+				continue
+			}
+			if fields == nil {
+				var err error
+				if fields, err = r.src(i, docs[k].ID); err != nil {
+					return err
+				}
+			}
+			if v := fields[s.field]; len(v) != 0 {
+				values[k][n] = v[0]
+			}
+		}
+	}
+
+	order := make([]int, len(docs))
+	for k := range order {
+		order[k] = k
+	}
+	sort.Slice(order, func(a, b int) bool {
+		x, y := order[a], order[b]
+		for n, s := range sorts {
+			var c int
+			if s.field == ScoreField {
+				c = compareScores(docs[x].Score, docs[y].Score)
+			} else {
+				vx, vy := values[x][n], values[y][n]
+				if vx == "" || vy == "" {
+					// missing values are last whatever the order
+					if vx != vy {
+						return vy == ""
+					}
+					continue
+				}
+				c = compareValues(vx, vy)
+			}
+			if s.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		if c := compareScores(docs[x].Score, docs[y].Score); c != 0 {
+			return c > 0
+		}
+		return docs[x].ID < docs[y].ID
+	})
+
+	sorted := make([]Doc, len(docs))
+	for k, n := range order {
+		sorted[k] = docs[n]
+	}
+	copy(docs, sorted)
+	return nil
+}
+
+func compareScores(a, b float32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareValues(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
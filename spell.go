@@ -0,0 +1,221 @@
+package fulltext
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// spellCandidates is the number of terms of the index a token may be
+	// corrected to, the closest and most frequent ones.
+	spellCandidates = 8
+	// spellBeam is the number of partial corrections kept while the tokens
+	// are corrected from left to right.
+	spellBeam = 16
+	// spellSuggestions is the number of corrections returned at most.
+	spellSuggestions = 3
+	// spellEditCost is the log probability lost per edit of a token.
+	spellEditCost = 3.0
+	// spellSmoothing is the document frequency given to a term the index
+	// does not have, so a known term some edits away is more likely.
+	spellSmoothing = 0.01
+	// spellLambda weighs the co-occurrence of two terms against the
+	// frequency of the second one.
+	spellLambda = 0.5
+)
+
+type spellCandidate struct {
+	term  string
+	edits int
+	df    uint32
+	tf    map[uint32]uint32
+}
+
+type correction struct {
+	candidates []int
+	score      float64
+}
+
+// SpellCheck returns corrections of text, the most likely first, made of the
+// terms of index within edits of its tokens. A correction is scored by the
+// edits it makes, the document frequency of its terms and how often each
+// term is found in the same documents as the previous one. It returns none
+// when text is likely right as it is.
+func (fulltext *Fulltext) SpellCheck(index, text string) ([]string, error) {
+	snap, err := fulltext.db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	r := reader{snap}
+
+	analyzer, fields, err := fulltext.defaultFields(r, index)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := r.ds(index)
+	if err != nil || ds == 0 {
+		return nil, err
+	}
+
+	text, tokens, _ := analyzer.analyze(text)
+	var words []Token
+	for k, token := range tokens {
+		if k == 0 || token.Pos != tokens[k-1].Pos {
+			words = append(words, token)
+		}
+	}
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	candidates := make([][]spellCandidate, len(words))
+	for k, word := range words {
+		if candidates[k], err = spellCandidatesOf(r, index, fields, word.Term); err != nil {
+			return nil, err
+		}
+	}
+
+	beam := []correction{{}}
+	for k := range words {
+		var next []correction
+		for _, c := range beam {
+			for n, candidate := range candidates[k] {
+				score := c.score - spellEditCost*float64(candidate.edits)
+				p := (float64(candidate.df) + spellSmoothing) / float64(ds+1)
+				if k > 0 {
+					prev := candidates[k-1][c.candidates[k-1]]
+					if prev.df > 0 {
+						p = (1-spellLambda)*p + spellLambda*float64(cooccurrences(prev.tf, candidate.tf))/float64(prev.df)
+					}
+				}
+				score += math.Log(p)
+
+				next = append(next, correction{append(c.candidates[:k:k], n), score})
+			}
+		}
+
+		sort.SliceStable(next, func(i, j int) bool { return next[i].score > next[j].score })
+		if len(next) > spellBeam {
+			next = next[:spellBeam]
+		}
+		beam = next
+	}
+
+	// the original tokens are the first candidates, the corrections that
+	// rank below them are unlikely
+	var corrections []string
+	for _, c := range beam {
+		changed := false
+		for k, n := range c.candidates {
+			changed = changed || candidates[k][n].edits > 0
+		}
+		if !changed {
+			break
+		}
+		corrections = append(corrections, spellText(text, words, candidates, c))
+		if len(corrections) == spellSuggestions {
+			break
+		}
+	}
+
+	return corrections, nil
+}
+
+// spellCandidatesOf returns term, first, and the terms within the automatic
+// fuzziness of it.
+func spellCandidatesOf(r reader, i string, fields []string, term string) ([]spellCandidate, error) {
+	candidates := []spellCandidate{{term: term}}
+	edits := fuzzyEdits(term, AutoFuzziness)
+	terms := []fuzzyTerm{{term: term}}
+	if edits > 0 {
+		expanded, err := fuzzyExpand(r, i, fields, term, edits, spellCandidates, 0, true)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, expanded...)
+	}
+
+	for k, ft := range terms {
+		if k > 0 && ft.term == term {
+			continue
+		}
+		tfidf, err := termTF(r, i, fields, ft.term)
+		if err != nil {
+			return nil, err
+		}
+		if tfidf == nil {
+			continue
+		}
+
+		candidate := spellCandidate{term: ft.term, edits: ft.edits, df: tfidf.tokenIDF, tf: tfidf.tokenTF}
+		if k == 0 {
+			candidates[0] = candidate
+		} else {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return candidates, nil
+}
+
+// cooccurrences counts the documents holding both terms.
+func cooccurrences(a, b map[uint32]uint32) int {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	n := 0
+	for num := range a {
+		if _, exist := b[num]; exist {
+			n++
+		}
+	}
+	return n
+}
+
+// spellText writes the correction into text, in place of the tokens it
+// changes.
+func spellText(text string, words []Token, candidates [][]spellCandidate, c correction) string {
+	var b strings.Builder
+	at := 0
+	for k, n := range c.candidates {
+		candidate := candidates[k][n]
+		if candidate.edits == 0 {
+			continue
+		}
+		word := words[k]
+		if word.Start < at {
+			continue
+		}
+		b.WriteString(text[at:word.Start])
+		b.WriteString(candidate.term)
+		at = word.End
+	}
+	b.WriteString(text[at:])
+
+	return b.String()
+}
+
+// defaultFields returns the analyzer of the unnamed field of index and the
+// text fields analysed like it.
+func (fulltext *Fulltext) defaultFields(r reader, i string) (*Analyzer, []string, error) {
+	mapping, err := r.mapping(i)
+	if err != nil {
+		return nil, nil, err
+	}
+	analyzer, err := fulltext.analyzer(mapping, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, err := fulltext.fieldGroups(mapping, mapping.textFields())
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, group := range groups {
+		if group.analyzer == analyzer {
+			return analyzer, group.fields, nil
+		}
+	}
+	return analyzer, nil, nil
+}
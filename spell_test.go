@@ -0,0 +1,71 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestFulltextSpellCheck(t *testing.T) {
+	index := "spell"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	docs := map[string]string{
+		"document_0": "information retrieval systems",
+		"document_1": "information retrieval models",
+		"document_2": "information theory",
+		"document_3": "retrieval of documents",
+		"document_4": "informal talk",
+		"document_5": "retrieval ranking",
+		"document_6": "banking models",
+		"document_7": "banking systems",
+	}
+	if err = fulltext.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+
+	tests := []struct {
+		text        string
+		corrections []string
+	}{
+		{"informaton retreival", []string{"information retrieval"}},
+		{"information retrieval", nil},
+		// both are one edit away, banking is more frequent but ranking is
+		// found with retrieval
+		{"retrieval xanking", []string{"retrieval ranking"}},
+		{"xanking", []string{"banking"}},
+		{"xyzzy", nil},
+	}
+	for _, test := range tests {
+		corrections, err := fulltext.SpellCheck(index, test.text)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(corrections) > 1 {
+			corrections = corrections[:1]
+		}
+		if !reflect.DeepEqual(corrections, test.corrections) {
+			t.Fatalf("%q: %q, want %q", test.text, corrections, test.corrections)
+		}
+	}
+
+	hits, err := fulltext.Search(new(Query).Index(index).Match("retreival").SpellCheck(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total != 0 || len(hits.Suggestions) == 0 || hits.Suggestions[0] != "retrieval" {
+		t.Fatalf("hits: %+v", hits)
+	}
+	hits, err = fulltext.Search(new(Query).Index(index).Match("retrieval").SpellCheck(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if hits.Total == 0 || hits.Suggestions != nil {
+		t.Fatalf("hits: %+v", hits)
+	}
+}
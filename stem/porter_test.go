@@ -0,0 +1,37 @@
+package stem
+
+import "testing"
+
+func TestPorter(t *testing.T) {
+	words := map[string]string{
+		"caresses":        "caress",
+		"ponies":          "poni",
+		"cats":            "cat",
+		"agreed":          "agre",
+		"feed":            "feed",
+		"plastered":       "plaster",
+		"motoring":        "motor",
+		"sing":            "sing",
+		"conflated":       "conflat",
+		"hopping":         "hop",
+		"falling":         "fall",
+		"filing":          "file",
+		"happy":           "happi",
+		"relational":      "relat",
+		"conditional":     "condit",
+		"generalizations": "gener",
+		"electrical":      "electr",
+		"adjustable":      "adjust",
+		"connection":      "connect",
+		"running":         "run",
+		"controlling":     "control",
+		"ranking":         "rank",
+		"is":              "is",
+		"bm25":            "bm25",
+	}
+	for word, want := range words {
+		if got := Porter(word); got != want {
+			t.Errorf("%s: %s want %s", word, got, want)
+		}
+	}
+}
@@ -1,35 +1,26 @@
 package fulltext
 
 import (
-	"errors"
+	"encoding/binary"
 	"fmt"
-	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/util"
+	"math"
 )
 
-func (fulltext *Fulltext) tf(i string, token string) (map[string]uint32, error) {
-	key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, tfKey, token))
-	val, err := fulltext.db.Get(key, nil)
-	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
-		return nil, err
-	}
-	if len(val) == 0 {
-		return nil, nil
-	}
-
-	match := make(map[string]uint32)
-	err = byteToAny(val, &match)
-	if err != nil {
-		return nil, err
-	}
+// reader runs the index lookups against the store or one of its snapshots.
+type reader struct {
+	KVReader
+}
 
-	return match, nil
+// fieldToken is a token of one field, the unit postings are kept for.
+type fieldToken struct {
+	field string
+	token string
 }
 
-func (fulltext *Fulltext) idf(i string, token string) (uint32, error) {
-	key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, idfKey, token))
-	val, err := fulltext.db.Get(key, nil)
-	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+func (r reader) idf(i, field, token string) (uint32, error) {
+	key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, fieldKind(idfKey, field), token))
+	val, err := r.Get(key)
+	if err != nil {
 		return 0, err
 	}
 	if len(val) == 0 {
@@ -40,10 +31,10 @@ func (fulltext *Fulltext) idf(i string, token string) (uint32, error) {
 	return idfVal, nil
 }
 
-func (fulltext *Fulltext) ts(i string) (uint64, error) {
-	key := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, tsKey))
-	val, err := fulltext.db.Get(key, nil)
-	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+func (r reader) ts(i, field string) (uint64, error) {
+	key := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, fieldKind(tsKey, field)))
+	val, err := r.Get(key)
+	if err != nil {
 		return 0, err
 	}
 	if len(val) == 0 {
@@ -54,10 +45,10 @@ func (fulltext *Fulltext) ts(i string) (uint64, error) {
 	return termSize, nil
 }
 
-func (fulltext *Fulltext) ds(i string) (uint32, error) {
+func (r reader) ds(i string) (uint32, error) {
 	key := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, dsKey))
-	val, err := fulltext.db.Get(key, nil)
-	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+	val, err := r.Get(key)
+	if err != nil {
 		return 0, err
 	}
 	if len(val) == 0 {
@@ -68,11 +59,29 @@ func (fulltext *Fulltext) ds(i string) (uint32, error) {
 	return docSize, nil
 }
 
-func (fulltext *Fulltext) docT(i, id string) (ret bool, doc docT, err error) {
-	content := make(map[string]map[string]struct{})
+func (r reader) mapping(i string) (*Mapping, error) {
+	key := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, mappingKey))
+	val, err := r.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) == 0 {
+		return nil, nil
+	}
+
+	mapping := &Mapping{}
+	err = byteToAny(val, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapping, nil
+}
+
+func (r reader) docT(i, id string) (ret bool, doc docT, err error) {
 	idKey := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, docKey, id))
-	tv, err := fulltext.db.Get(idKey, nil)
-	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+	tv, err := r.Get(idKey)
+	if err != nil {
 		return
 	}
 
@@ -86,99 +95,218 @@ func (fulltext *Fulltext) docT(i, id string) (ret bool, doc docT, err error) {
 		return
 	}
 
-	for _, token := range ts.T {
-		content[token] = make(map[string]struct{})
-		content[token][id] = struct{}{}
-	}
 	ret = true
-	doc = docT{idKey, content, ts.S}
+	doc = docT{id: id, fields: ts.fields()}
 
 	return
 }
 
-func (fulltext *Fulltext) t(i string, token string, size int) ([]string, error) {
-	key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, tfKey, token))
-	var tsK []string
-	var count int
-	iter := fulltext.db.NewIterator(util.BytesPrefix(key), nil)
-	for iter.Next() {
-		if count == size {
-			break
-		} else {
-			tsK = append(tsK, string(iter.Key()))
-		}
-		count++
+func (r reader) src(i, id string) (map[string][]string, error) {
+	key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, srcKey, id))
+	val, err := r.Get(key)
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err := iter.Error()
+	if len(val) == 0 {
+		return nil, nil
+	}
+
+	fields := make(map[string][]string)
+	err = byteToAny(val, &fields)
 	if err != nil {
 		return nil, err
 	}
 
-	return tsK, nil
+	return fields, nil
 }
 
-func (fulltext *Fulltext) addMeta(i string, tf map[string]map[string]uint32, idf map[string]uint32, idt map[string]idTS, ts uint64, ds uint32) error {
-	batch := new(leveldb.Batch)
-	for k, v := range tf {
-		val, err := anyToByte(v)
+func normK(i, field string, num uint32) []byte {
+	key := []byte(fmt.Sprintf("%s:%s:%s:", indexKey, i, fieldKind(normKey, field)))
+	return binary.BigEndian.AppendUint32(key, num)
+}
+
+func (r reader) docLen(i, field string, num uint32) (uint32, error) {
+	val, err := r.Get(normK(i, field, num))
+	if err != nil || len(val) == 0 {
+		return 0, err
+	}
+
+	return byteToUint32(val), nil
+}
+
+func (r reader) docsLen(i, field string, nums map[uint32]struct{}) (map[uint32]uint32, error) {
+	lens := make(map[uint32]uint32, len(nums))
+	for num := range nums {
+		l, err := r.docLen(i, field, num)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		lens[num] = l
+	}
 
-		key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, tfKey, k))
-		batch.Put(key, val)
+	return lens, nil
+}
+
+// change is what adding or removing a batch of documents does to an index.
+type change struct {
+	r        reader
+	i        string
+	postings *postingsWriter
+	idf      map[fieldToken]uint32
+	ts       map[string]uint64
+	ds       uint32
+	seq      uint32
+	// olds are the entries of replaced or removed documents, dropped before
+	// the ones of idt and srcs are written
+	olds []docT
+	idt  map[string]idTS
+	srcs map[string]map[string][]string
+	// nums numbers the documents of idt. Numbers come from free first, the
+	// ones taken are in reused, and those of removed documents in freed.
+	nums     map[string]uint32
+	free     []uint32
+	freeRead bool // free holds every free number left
+	reused   []uint32
+	freed    map[string]uint32
+	mapping  *Mapping
+}
+
+func newChange(r reader, i string) (*change, error) {
+	if err := r.checkLayout(i); err != nil {
+		return nil, err
 	}
 
-	for k, v := range idf {
-		val := uint32ToByte(v)
-		key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, idfKey, k))
-		batch.Put(key, val)
+	c := &change{
+		r:        r,
+		i:        i,
+		postings: newPostingsWriter(r, i),
+		idf:      make(map[fieldToken]uint32),
+		ts:       make(map[string]uint64),
+		idt:      make(map[string]idTS),
+		srcs:     make(map[string]map[string][]string),
+		nums:     make(map[string]uint32),
+		freed:    make(map[string]uint32),
 	}
 
-	for k, v := range idt {
-		val, err := anyToByte(v)
-		if err != nil {
-			return err
-		}
+	var err error
+	if c.ds, err = r.ds(i); err != nil {
+		return nil, err
+	}
+	if c.seq, err = r.seq(i); err != nil {
+		return nil, err
+	}
 
-		key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, docKey, k))
-		batch.Put(key, val)
+	return c, nil
+}
+
+// loadFree makes sure the next n numbers handed out are the free ones, if
+// there are that many.
+func (c *change) loadFree(n int) error {
+	if len(c.free) >= n || c.freeRead {
+		return nil
 	}
 
-	tsK := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, tsKey))
-	tsV := uint64ToByte(ts)
-	batch.Put(tsK, tsV)
+	// reused were the smallest free numbers, they are still stored as free
+	free, err := c.r.freeNums(c.i, len(c.reused)+n)
+	if err != nil {
+		return err
+	}
+	c.free = free[len(c.reused):]
+	c.freeRead = len(c.free) < n
+	return nil
+}
 
-	dsK := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, dsKey))
-	dsV := uint32ToByte(ds)
-	batch.Put(dsK, dsV)
+// alloc hands out the smallest free number, or a new one.
+func (c *change) alloc() uint32 {
+	if len(c.free) != 0 {
+		num := c.free[0]
+		c.free = c.free[1:]
+		c.reused = append(c.reused, num)
+		return num
+	}
 
-	err := fulltext.db.Write(batch, nil)
+	num := c.seq
+	c.seq++
+	return num
+}
+
+// loadIDF and loadTS read a statistic the first time the batch changes it.
+func (c *change) loadIDF(ft fieldToken) error {
+	if _, exist := c.idf[ft]; exist {
+		return nil
+	}
+
+	idfVal, err := c.r.idf(c.i, ft.field, ft.token)
 	if err != nil {
 		return err
 	}
+	c.idf[ft] = idfVal
+	return nil
+}
+
+func (c *change) loadTS(field string) error {
+	if _, exist := c.ts[field]; exist {
+		return nil
+	}
 
+	tsVal, err := c.r.ts(c.i, field)
+	if err != nil {
+		return err
+	}
+	c.ts[field] = tsVal
 	return nil
 }
 
-func (fulltext *Fulltext) removeMeta(i string, tf map[string]map[string]uint32, idf map[string]uint32, idsK [][]byte, ts uint64, ds uint32) error {
-	batch := new(leveldb.Batch)
-	for k, v := range tf {
-		val, err := anyToByte(v)
-		if err != nil {
+// unindex takes the tokens and lengths of doc, numbered num, out of the
+// statistics and postings.
+func (c *change) unindex(doc docT, num uint32) error {
+	c.ds--
+
+	for field, fts := range doc.fields {
+		if err := c.loadTS(field); err != nil {
 			return err
 		}
-		key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, tfKey, k))
-		if len(v) == 0 {
-			batch.Delete(key)
-		} else {
-			batch.Put(key, val)
+		c.ts[field] -= uint64(fts.S)
+
+		for _, token := range fts.T {
+			ft := fieldToken{field, token}
+			removed, err := c.postings.del(ft, num)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				continue
+			}
+			if err := c.loadIDF(ft); err != nil {
+				return err
+			}
+			c.idf[ft]--
 		}
 	}
 
-	for k, v := range idf {
-		key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, idfKey, k))
+	doc.num = num
+	c.olds = append(c.olds, doc)
+	return nil
+}
+
+// putMeta writes a change in one batch.
+func (fulltext *Fulltext) putMeta(i string, c *change) error {
+	batch, err := fulltext.metaBatch(i, c)
+	if err != nil {
+		return err
+	}
+
+	return fulltext.db.Write(batch)
+}
+
+// metaBatch turns a change into a batch. Emptied entries are deleted.
+func (fulltext *Fulltext) metaBatch(i string, c *change) (Batch, error) {
+	batch := fulltext.db.NewBatch()
+
+	c.postings.flush(batch)
+
+	for k, v := range c.idf {
+		key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, fieldKind(idfKey, k.field), k.token))
 		if v == 0 {
 			batch.Delete(key)
 		} else {
@@ -187,43 +315,114 @@ func (fulltext *Fulltext) removeMeta(i string, tf map[string]map[string]uint32,
 		}
 	}
 
-	for _, idK := range idsK {
-		batch.Delete(idK)
+	for _, old := range c.olds {
+		batch.Delete([]byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, docKey, old.id)))
+		batch.Delete([]byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, srcKey, old.id)))
+		for field := range old.fields {
+			batch.Delete(normK(i, field, old.num))
+		}
 	}
 
-	tsK := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, tsKey))
-	if ts == 0 {
-		batch.Delete(tsK)
-	} else {
-		tsV := uint64ToByte(ts)
-		batch.Put(tsK, tsV)
+	for k, v := range c.idt {
+		val, err := anyToByte(v)
+		if err != nil {
+			return nil, err
+		}
+
+		key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, docKey, k))
+		batch.Put(key, val)
+
+		for field, fts := range v.fields() {
+			batch.Put(normK(i, field, c.nums[k]), uint32ToByte(fts.S))
+		}
+	}
+
+	for k, v := range c.srcs {
+		val, err := anyToByte(v)
+		if err != nil {
+			return nil, err
+		}
+
+		key := []byte(fmt.Sprintf("%s:%s:%s:%s", indexKey, i, srcKey, k))
+		batch.Put(key, val)
+	}
+
+	for id, num := range c.freed {
+		batch.Delete(numK(i, id))
+		batch.Delete(ridK(i, num))
+		if c.ds != 0 {
+			batch.Put(freeK(i, num), nil)
+		}
+	}
+
+	for _, num := range c.reused {
+		batch.Delete(freeK(i, num))
+	}
+
+	// an emptied index numbers its documents from 0 again
+	if c.ds == 0 {
+		c.seq = 0
+		free, err := reader{fulltext.db}.freeNums(i, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		for _, num := range free {
+			batch.Delete(freeK(i, num))
+		}
+	}
+
+	for id, num := range c.nums {
+		batch.Put(numK(i, id), uint32ToByte(num))
+		batch.Put(ridK(i, num), []byte(id))
+	}
+
+	if c.mapping != nil {
+		if err := putMapping(batch, i, c.mapping); err != nil {
+			return nil, err
+		}
+	}
+
+	for field, v := range c.ts {
+		tsK := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, fieldKind(tsKey, field)))
+		if v == 0 {
+			batch.Delete(tsK)
+		} else {
+			batch.Put(tsK, uint64ToByte(v))
+		}
 	}
 
 	dsK := []byte(fmt.Sprintf("%s:%s:%s", indexKey, i, dsKey))
-	if ds == 0 {
+	if c.ds == 0 {
 		batch.Delete(dsK)
 	} else {
-		dsV := uint32ToByte(ds)
+		dsV := uint32ToByte(c.ds)
 		batch.Put(dsK, dsV)
 	}
 
-	err := fulltext.db.Write(batch, nil)
+	batch.Put([]byte(fmt.Sprintf("%s:%s:%s", indexKey, i, seqKey)), uint32ToByte(c.seq))
+	batch.Put([]byte(fmt.Sprintf("%s:%s:%s", indexKey, i, verKey)), uint32ToByte(layoutVersion))
+
+	return batch, nil
+}
+
+func putMapping(batch Batch, i string, mapping *Mapping) error {
+	val, err := anyToByte(mapping)
 	if err != nil {
 		return err
 	}
-
+	batch.Put([]byte(fmt.Sprintf("%s:%s:%s", indexKey, i, mappingKey)), val)
 	return nil
 }
 
 func (fulltext *Fulltext) removeIndex(i string) error {
 	key := []byte(fmt.Sprintf("%s:%s:", indexKey, i))
 
-	batch := new(leveldb.Batch)
+	batch := fulltext.db.NewBatch()
 	var count int
-	iter := fulltext.db.NewIterator(util.BytesPrefix(key), nil)
+	iter := fulltext.db.NewIterator(key)
 	for iter.Next() {
 		if count == 20000 {
-			err := fulltext.db.Write(batch, nil)
+			err := fulltext.db.Write(batch)
 			if err != nil {
 				return err
 			}
@@ -241,7 +440,7 @@ func (fulltext *Fulltext) removeIndex(i string) error {
 	}
 
 	if count > 0 {
-		err = fulltext.db.Write(batch, nil)
+		err = fulltext.db.Write(batch)
 		if err != nil {
 			return err
 		}
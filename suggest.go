@@ -1,53 +1,119 @@
 package fulltext
 
 import (
-	"golang.org/x/sync/errgroup"
-	"strings"
-	"sync"
+	"sort"
 )
 
-func (fulltext *Fulltext) Suggest(index, query string) ([]string, error) {
-	var mutex sync.Mutex
-	var eg errgroup.Group
-	var size int
-	ts := make([]string, 0, 15)
+// suggestCandidates is the number of the most frequent completions checked
+// for following the token before the partial one.
+const suggestCandidates = 100
 
-	tokens := fulltext.tokenizer.Seg(query)
+type suggestion struct {
+	term    string
+	df      uint32
+	phrases int
+}
+
+// Suggest completes the last token of text, as it is being typed, with the
+// terms of index starting with it, in the fields analysed like the unnamed
+// one. It returns text with the token completed, at most the page size of
+// them. The completions that follow the previous token of text in some
+// document come first, then the ones in the most documents.
+func (fulltext *Fulltext) Suggest(index, text string) ([]string, error) {
+	return fulltext.SuggestN(index, text, 0)
+}
+
+// SuggestN is Suggest returning at most size completions, the page size
+// with 0.
+func (fulltext *Fulltext) SuggestN(index, text string, size int) ([]string, error) {
+	if size <= 0 {
+		size = fulltext.retSize
+	}
+
+	snap, err := fulltext.db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	r := reader{snap}
+
+	analyzer, fields, err := fulltext.defaultFields(r, index)
+	if err != nil {
+		return nil, err
+	}
 
-	l := len(tokens)
-	if l < 4 {
-		size = 4
-	} else if l > 3 && l < 6 {
-		size = 3
-	} else {
+	// the partial token ends the text, a text ending with a space or a
+	// dropped token has nothing to complete
+	text, tokens, _ := analyzer.analyze(text)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	last := len(tokens) - 1
+	for last > 0 && tokens[last-1].Pos == tokens[last].Pos {
+		last--
+	}
+	partial := tokens[last]
+	if partial.Start < 0 || partial.End != len(text) {
 		return nil, nil
 	}
+	var prev string
+	if last > 0 && tokens[last-1].Pos == partial.Pos-1 {
+		prev = tokens[last-1].Term
+	}
 
-	for _, token := range tokens {
-		if _, exist := fulltext.stopWords[token]; exist {
-			continue
+	dfs := make(map[string]uint32)
+	for _, field := range fields {
+		err := r.terms(index, field, partial.Term, func(term string, df uint32) bool {
+			dfs[term] += df
+			return true
+		})
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		token := token
-		eg.Go(func() error {
+	suggestions := make([]suggestion, 0, len(dfs))
+	for term, df := range dfs {
+		suggestions = append(suggestions, suggestion{term: term, df: df})
+	}
+	sortSuggestions(suggestions)
 
-			tKs, err := fulltext.t(index, token, size)
-			if err != nil {
-				return err
-			}
-			mutex.Lock()
-			defer mutex.Unlock()
-			for _, t := range tKs {
-				i := strings.LastIndex(t, ":")
-				ts = append(ts, t[i+1:])
+	if prev != "" {
+		if len(suggestions) > suggestCandidates {
+			suggestions = suggestions[:suggestCandidates]
+		}
+		for k := range suggestions {
+			for _, field := range fields {
+				tf, err := fieldPhraseTF(r, index, field, []string{prev, suggestions[k].term}, []uint32{0, 1}, 0)
+				if err != nil {
+					return nil, err
+				}
+				suggestions[k].phrases += len(tf)
 			}
-			return nil
-		})
+		}
+		sortSuggestions(suggestions)
 	}
 
-	if err := eg.Wait(); err != nil {
-		return nil, err
+	if len(suggestions) > size {
+		suggestions = suggestions[:size]
+	}
+	completions := make([]string, 0, len(suggestions))
+	for _, s := range suggestions {
+		completions = append(completions, text[:partial.Start]+s.term)
 	}
 
-	return ts, nil
+	return completions, nil
+}
+
+func sortSuggestions(suggestions []suggestion) {
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.phrases != b.phrases {
+			return a.phrases > b.phrases
+		}
+		if a.df != b.df {
+			return a.df > b.df
+		}
+		return a.term < b.term
+	})
 }
@@ -0,0 +1,52 @@
+package fulltext
+
+import (
+	"github.com/744189447/fulltext/seg"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestFulltextSuggest(t *testing.T) {
+	index := "suggest"
+	fulltext, err := NewWithKV(NewMemKV(), &seg.EnTokenizer{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fulltext.Free()
+
+	docs := map[string]string{
+		"document_0": "information retrieval",
+		"document_1": "information theory",
+		"document_2": "information systems",
+		"document_3": "informal talk",
+		"document_4": "a very informal meeting",
+	}
+	if err = fulltext.AddDocs(index, docs); err != nil {
+		log.Fatal(err)
+	}
+	if err = fulltext.AddDocuments(index, NewDocument("document_5").Add("title", "information")); err != nil {
+		log.Fatal(err)
+	}
+
+	tests := []struct {
+		text        string
+		size        int
+		completions []string
+	}{
+		{"infor", 10, []string{"information", "informal"}},
+		{"infor", 1, []string{"information"}},
+		{"a very infor", 10, []string{"a very informal", "a very information"}},
+		{"information ", 10, nil},
+		{"xyz", 10, []string{}},
+	}
+	for _, test := range tests {
+		completions, err := fulltext.SuggestN(index, test.text, test.size)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !reflect.DeepEqual(completions, test.completions) {
+			t.Fatalf("%q: %q, want %q", test.text, completions, test.completions)
+		}
+	}
+}
@@ -23,6 +23,7 @@ func readSplitter(file string, splitter byte) (lines []string, err error) {
 		}
 		return
 	}
+	defer fin.Close()
 
 	r := bufio.NewReader(fin)
 	for {